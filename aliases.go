@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// aliases can use other aliases, this stops loops
+const maxAliasDepth = 8
+
+// $1 to $9 are replaced by positional arguments, $* by all arguments
+var aliasArg = regexp.MustCompile(`\$([1-9*])`)
+
+// aliasSteps splits an alias at ";" into the commands or messages it runs,
+// "\;" is a literal semicolon.
+func aliasSteps(alias string) []string {
+	var steps []string
+	var step strings.Builder
+	add := func() {
+		if s := strings.TrimSpace(step.String()); s != "" {
+			steps = append(steps, s)
+		}
+		step.Reset()
+	}
+	for i := 0; i < len(alias); i++ {
+		switch {
+		case strings.HasPrefix(alias[i:], `\;`):
+			step.WriteByte(';')
+			i++
+		case alias[i] == ';':
+			add()
+		default:
+			step.WriteByte(alias[i])
+		}
+	}
+	add()
+	return steps
+}
+
+func (c *chat) validateAlias(name string, alias string) error {
+	if name == "" || strings.ContainsAny(name, " \t/") {
+		return fmt.Errorf("invalid alias name %q", name)
+	}
+	if _, ok := c.commands["/"+name]; ok {
+		return fmt.Errorf("/%s is a builtin command", name)
+	}
+	if len(aliasSteps(alias)) == 0 {
+		return fmt.Errorf("alias /%s is empty", name)
+	}
+	return nil
+}
+
+// checkAliases warns about aliases in the config that are ignored, e.g. ones
+// named like a builtin command added after the alias was defined. Call it once
+// the output is set up, headless mode prints the warnings.
+func (c *chat) checkAliases() {
+	c.config.RLock()
+	defer c.config.RUnlock()
+
+	names := make([]string, 0, len(c.config.Aliases))
+	for name := range c.config.Aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := c.validateAlias(name, c.config.Aliases[name]); err != nil {
+			c.renderError(fmt.Sprintf("ignoring alias: %v", err))
+		}
+	}
+}
+
+// expandArgs replaces the argument placeholders of step.
+func expandArgs(step string, args []string) (string, error) {
+	var err error
+	expanded := aliasArg.ReplaceAllStringFunc(step, func(placeholder string) string {
+		if placeholder == "$*" {
+			return strings.Join(args, " ")
+		}
+		n, _ := strconv.Atoi(placeholder[1:])
+		if n > len(args) {
+			err = fmt.Errorf("missing argument %s", placeholder)
+			return ""
+		}
+		return args[n-1]
+	})
+	return strings.TrimSpace(expanded), err
+}
+
+// alias returns the alias called name, ignored aliases are not found.
+func (c *chat) alias(name string) (string, bool) {
+	c.config.RLock()
+	defer c.config.RUnlock()
+	name = strings.TrimPrefix(name, "/")
+	alias, ok := c.config.Aliases[name]
+	if !ok || c.validateAlias(name, alias) != nil {
+		return "", false
+	}
+	return alias, true
+}
+
+func (c *chat) aliasNames() []string {
+	c.config.RLock()
+	defer c.config.RUnlock()
+	names := make([]string, 0, len(c.config.Aliases))
+	for name, alias := range c.config.Aliases {
+		if c.validateAlias(name, alias) == nil {
+			names = append(names, "/"+name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// runAlias runs every step of an alias like it was typed into the input view.
+func (c *chat) runAlias(alias string, tokens []string, depth int) error {
+	if depth >= maxAliasDepth {
+		return fmt.Errorf("%s: aliases nested too deep", tokens[0])
+	}
+
+	steps := aliasSteps(alias)
+	expanded := make([]string, 0, len(steps))
+	for _, step := range steps {
+		s, err := expandArgs(step, tokens[1:])
+		if err != nil {
+			return fmt.Errorf("%s: %v", tokens[0], err)
+		}
+		if s != "" {
+			expanded = append(expanded, s)
+		}
+	}
+
+	// nothing is sent if an argument is missing in any step
+	for _, s := range expanded {
+		if err := c.dispatch(s, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addAlias(c *chat, tokens []string) error {
+	if len(tokens) == 1 {
+		names := c.aliasNames()
+		if len(names) == 0 {
+			c.renderCommand("No aliases defined")
+			return nil
+		}
+		for _, name := range names {
+			alias, _ := c.alias(name)
+			c.renderCommand(fmt.Sprintf("%s = %s", name, alias))
+		}
+		return nil
+	}
+
+	name := strings.TrimPrefix(tokens[1], "/")
+	if len(tokens) == 2 {
+		alias, ok := c.alias(name)
+		if !ok {
+			return fmt.Errorf("/%s is not an alias", name)
+		}
+		c.renderCommand(fmt.Sprintf("/%s = %s", name, alias))
+		return nil
+	}
+
+	alias := strings.Join(tokens[2:], " ")
+	if err := c.validateAlias(name, alias); err != nil {
+		return err
+	}
+
+	c.config.Lock()
+	if c.config.Aliases == nil {
+		c.config.Aliases = make(map[string]string)
+	}
+	c.config.Aliases[name] = alias
+	c.config.Unlock()
+
+	err := c.config.save()
+	if err != nil {
+		return err
+	}
+	c.renderHelp()
+	c.renderCommand(fmt.Sprintf("Added alias /%s = %s", name, alias))
+	return nil
+}
+
+func removeAlias(c *chat, tokens []string) error {
+	if len(tokens) != 2 {
+		return errors.New("usage: /unalias name")
+	}
+
+	name := strings.TrimPrefix(tokens[1], "/")
+	c.config.Lock()
+	_, ok := c.config.Aliases[name]
+	delete(c.config.Aliases, name)
+	c.config.Unlock()
+
+	if !ok {
+		return fmt.Errorf("/%s is not an alias", name)
+	}
+
+	err := c.config.save()
+	if err != nil {
+		return err
+	}
+	c.renderHelp()
+	c.renderCommand(fmt.Sprintf("Removed alias /%s", name))
+	return nil
+}
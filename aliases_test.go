@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAliases(t *testing.T) {
+	cfg := testConfig()
+	cfg.Aliases = map[string]string{
+		"m":     "/mute $1 600",
+		"greet": "/w $1 hi $2; hello $*",
+		"gm":    "/greet $1 morning",
+		"loop":  "/loop",
+		"semi":  `wait\; what; /me $1\;`,
+	}
+
+	tests := []struct {
+		input string
+		sent  []string
+		err   string
+	}{
+		{"/m bob", []string{"MUTE bob 10m0s"}, ""},
+		{"/greet bob there", []string{"PRIVMSG bob hi there", "MSG hello bob there"}, ""},
+		{"/gm bob", []string{"PRIVMSG bob hi morning", "MSG hello bob morning"}, ""},
+		{"/greet bob", []string{}, "*Error sending message: /greet: missing argument $2*"},
+		{"/loop", []string{}, "*Error sending message: /loop: aliases nested too deep*"},
+		{"/semi waves", []string{"MSG wait; what", "MSG /me waves;"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			s := &fakeSession{}
+			c := newTestChat(t, cfg, s)
+			c.handleInput(tt.input)
+
+			if sent := s.messages(); !reflect.DeepEqual(sent, tt.sent) {
+				t.Errorf("sent %q, want %q", sent, tt.sent)
+			}
+			if tt.err != "" && countLines(c.guiwrapper, tt.err) != 1 {
+				t.Errorf("missing error %q, rendered %q", tt.err, lines(c.guiwrapper))
+			}
+		})
+	}
+}
+
+func TestAliasCommands(t *testing.T) {
+	defer func(f string) { configFile = f }(configFile)
+	configFile = filepath.Join(t.TempDir(), "config.toml")
+
+	s := &fakeSession{}
+	c := newTestChat(t, testConfig(), s)
+
+	c.handleInput("/alias w /mute $1")
+	if countLines(c.guiwrapper, "/w is a builtin command") != 1 {
+		t.Errorf("builtin command was replaced by an alias")
+	}
+
+	c.handleInput(`/alias s a\; b`)
+	c.handleInput("/s")
+	c.handleInput("/alias m /mute $1 60")
+	c.handleInput("/m bob")
+	c.handleInput("/unalias m")
+	c.handleInput("/m bob")
+
+	if want := []string{"MSG a; b", "MUTE bob 1m0s"}; !reflect.DeepEqual(s.messages(), want) {
+		t.Errorf("sent %q, want %q", s.messages(), want)
+	}
+	if countLines(c.guiwrapper, "unknown command: /m") != 1 {
+		t.Errorf("alias still active after /unalias")
+	}
+}
+
+func TestIgnoredAliases(t *testing.T) {
+	cfg := testConfig()
+	cfg.Aliases = map[string]string{
+		"me":    "/w bob waves",
+		"a b":   "/me waves",
+		"empty": " ; ",
+		"wave":  "/me waves",
+	}
+	s := &fakeSession{}
+	c := newTestChat(t, cfg, s)
+	var out, errs bytes.Buffer
+	c.headless = &headless{out: &out, errs: &errs}
+	c.checkAliases()
+
+	for _, warning := range []string{
+		`ignoring alias: invalid alias name "a b"`,
+		"ignoring alias: alias /empty is empty",
+		"ignoring alias: /me is a builtin command",
+	} {
+		if countLines(c.guiwrapper, warning) != 1 {
+			t.Errorf("missing warning %q, rendered %q", warning, lines(c.guiwrapper))
+		}
+		if !strings.Contains(errs.String(), warning) {
+			t.Errorf("warning %q not printed when headless: %q", warning, errs.String())
+		}
+	}
+
+	c.handleInput("/me hi")
+	c.handleInput("/wave")
+	if want := []string{"MSG /me hi", "MSG /me waves"}; !reflect.DeepEqual(s.messages(), want) {
+		t.Errorf("sent %q, want %q", s.messages(), want)
+	}
+	if names := c.aliasNames(); !reflect.DeepEqual(names, []string{"/wave"}) {
+		t.Errorf("aliases %q, want only /wave", names)
+	}
+}
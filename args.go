@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// nextArg reads one argument from s. Arguments are separated by whitespace,
+// single and double quotes at the start of an argument group words and
+// outside of single quotes a backslash escapes quotes, backslashes and
+// whitespace. Quotes inside a word like don't are kept, as are other
+// backslashes, so regular expressions like \bword\b need no escaping.
+func nextArg(s string) (arg string, rest string, ok bool, err error) {
+	s = strings.TrimLeftFunc(s, unicode.IsSpace)
+	if s == "" {
+		return "", "", false, nil
+	}
+
+	var b strings.Builder
+	var quote rune
+	escaped := false
+	for i, r := range s {
+		switch {
+		case escaped:
+			if !strings.ContainsRune(`"'\`, r) && !unicode.IsSpace(r) {
+				b.WriteRune('\\')
+			}
+			b.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			b.WriteRune(r)
+		case i == 0 && (r == '"' || r == '\''):
+			quote = r
+		case unicode.IsSpace(r):
+			return b.String(), s[i:], true, nil
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	if quote != 0 {
+		return "", "", false, fmt.Errorf("missing closing %c", quote)
+	}
+	if escaped {
+		b.WriteRune('\\')
+	}
+	return b.String(), "", true, nil
+}
+
+// parseArgs splits a command line into arguments. If max is above zero,
+// only max arguments are parsed and the rest of the line is added verbatim
+// as the last argument, for free text like messages. Flags like --ip right
+// after the command don't count towards max.
+func parseArgs(s string, max int) ([]string, error) {
+	var args []string
+	flags := 0
+	for max <= 0 || len(args)-flags < max {
+		arg, rest, ok, err := nextArg(s)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return args, nil
+		}
+		if len(args) == flags+1 && strings.HasPrefix(arg, "--") {
+			flags++
+		}
+		args = append(args, arg)
+		s = rest
+	}
+
+	if text := strings.TrimSpace(s); text != "" {
+		args = append(args, text)
+	}
+	return args, nil
+}
+
+// takeFlag removes all occurrences of the given flags from args and reports whether one was present.
+func takeFlag(args []string, names ...string) (bool, []string) {
+	found := false
+	rest := make([]string, 0, len(args))
+	for _, a := range args {
+		if contains(names, a) {
+			found = true
+			continue
+		}
+		rest = append(rest, a)
+	}
+	return found, rest
+}
+
+var durationPart = regexp.MustCompile(`(\d+)([smhdw])`)
+
+// longest duration accepted, larger values would overflow time.Duration
+const maxDuration = 520 * 7 * 24 * time.Hour
+
+// parseDuration parses durations like 90, 10m, 2h, 1d or 1d12h. Plain numbers are seconds.
+func parseDuration(s string) (time.Duration, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if n < 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		if n > int64(maxDuration/time.Second) {
+			return 0, fmt.Errorf("duration %q is too long, at most 520w", s)
+		}
+		return time.Duration(n) * time.Second, nil
+	}
+
+	if s == "" || durationPart.ReplaceAllString(s, "") != "" {
+		return 0, fmt.Errorf("invalid duration %q, use e.g. 30s, 10m, 2h or 1d", s)
+	}
+
+	units := map[string]time.Duration{
+		"s": time.Second,
+		"m": time.Minute,
+		"h": time.Hour,
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+	}
+	var d time.Duration
+	for _, m := range durationPart.FindAllStringSubmatch(s, -1) {
+		n, err := strconv.ParseInt(m[1], 10, 64)
+		unit := units[m[2]]
+		if err != nil || n > int64(maxDuration/unit) {
+			return 0, fmt.Errorf("duration %q is too long, at most 520w", s)
+		}
+		d += time.Duration(n) * unit
+		if d > maxDuration {
+			return 0, fmt.Errorf("duration %q is too long, at most 520w", s)
+		}
+	}
+	if d <= 0 {
+		return 0, errors.New("duration must be positive")
+	}
+	return d, nil
+}
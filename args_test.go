@@ -0,0 +1,72 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		line string
+		max  int
+		want []string
+		err  bool
+	}{
+		{"/ban bob spam", 0, []string{"/ban", "bob", "spam"}, false},
+		{`/ban  bob "spamming links"  1h`, 0, []string{"/ban", "bob", "spamming links", "1h"}, false},
+		{`/tag 'bob the' red`, 0, []string{"/tag", "bob the", "red"}, false},
+		{`/highlight it\'s \bword\b`, 0, []string{"/highlight", "it's", `\bword\b`}, false},
+		{`/highlight two\ words`, 0, []string{"/highlight", "two words"}, false},
+		{`/w bob "hi"  there`, 2, []string{"/w", "bob", `"hi"  there`}, false},
+		{"/w bob", 2, []string{"/w", "bob"}, false},
+		{`/ban bob "spam`, 0, nil, true},
+		{`/alias nope don't do it`, 0, []string{"/alias", "nope", "don't", "do", "it"}, false},
+		{`/tag bob's "red"`, 0, []string{"/tag", "bob's", "red"}, false},
+		{`/ban --ip bob don't "spam" 1d`, 2, []string{"/ban", "--ip", "bob", `don't "spam" 1d`}, false},
+		{`/me --ip  waves`, 1, []string{"/me", "--ip  waves"}, false},
+	}
+
+	for _, tt := range tests {
+		got, err := parseArgs(tt.line, tt.max)
+		if (err != nil) != tt.err {
+			t.Errorf("parseArgs(%q) error %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseArgs(%q, %d) = %q, want %q", tt.line, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		err  bool
+	}{
+		{"600", 10 * time.Minute, false},
+		{"0", 0, false},
+		{"10m", 10 * time.Minute, false},
+		{"2H", 2 * time.Hour, false},
+		{"1d12h", 36 * time.Hour, false},
+		{"1w", 7 * 24 * time.Hour, false},
+		{"-5", 0, true},
+		{"10x", 0, true},
+		{"spam", 0, true},
+		{"", 0, true},
+		{"520w", maxDuration, false},
+		{"521w", 0, true},
+		{"99999999999w", 0, true},
+		{"99999999999999999999s", 0, true},
+		{"999999999999", 0, true},
+		{"500w500w", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseDuration(tt.in)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("parseDuration(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// buffers keeps one guiwrapper per conversation. The first buffer is always
+// the main channel, every whisper partner gets their own buffer on demand.
+type buffers struct {
+	gui     updater
+	theme   *theme
+	list    []*guiwrapper
+	current int
+	sync.RWMutex
+}
+
+func newBuffers(g updater, main *guiwrapper) *buffers {
+	b := &buffers{
+		gui:   g,
+		theme: main.theme,
+		list:  []*guiwrapper{main},
+	}
+	main.active = true
+	main.onUnread = b.renderTabBar
+	return b
+}
+
+// active returns the buffer currently drawn into the "messages" view.
+func (b *buffers) active() *guiwrapper {
+	b.RLock()
+	defer b.RUnlock()
+	return b.list[b.current]
+}
+
+// privateTarget returns the whisper partner of the active buffer, if any.
+func (b *buffers) privateTarget() (string, bool) {
+	gw := b.active()
+	return gw.name, gw.private
+}
+
+func (b *buffers) indexOf(nick string) int {
+	for i, gw := range b.list {
+		if gw.private && strings.EqualFold(gw.name, nick) {
+			return i
+		}
+	}
+	return -1
+}
+
+// private returns the buffer for the whisper conversation with nick,
+// creating it if it does not exist yet.
+func (b *buffers) private(nick string) *guiwrapper {
+	b.Lock()
+	if i := b.indexOf(nick); i != -1 {
+		gw := b.list[i]
+		b.Unlock()
+		return gw
+	}
+
+	main := b.list[0]
+	gw := &guiwrapper{
+		gui:        b.gui,
+		theme:      main.theme,
+		name:       nick,
+		private:    true,
+		messages:   []*guimessage{},
+		maxlines:   main.maxlines,
+		timeformat: main.timeformat,
+		onUnread:   b.renderTabBar,
+	}
+	b.list = append(b.list, gw)
+	b.Unlock()
+
+	b.renderTabBar()
+	return gw
+}
+
+// showPrivate opens the whisper buffer of nick and makes it the active one.
+func (b *buffers) showPrivate(nick string) {
+	b.private(nick)
+	b.RLock()
+	index := b.indexOf(nick)
+	b.RUnlock()
+	b.switchTo(index)
+}
+
+func (b *buffers) switchTo(index int) {
+	b.Lock()
+	if index < 0 || index >= len(b.list) {
+		b.Unlock()
+		return
+	}
+
+	old := b.list[b.current]
+	old.Lock()
+	old.active = false
+	old.Unlock()
+
+	b.current = index
+	gw := b.list[index]
+	gw.Lock()
+	gw.active = true
+	gw.unread = 0
+	gw.scrolledUp = false
+	title := gw.title()
+	gw.Unlock()
+	b.Unlock()
+
+	b.gui.Update(func(g *gocui.Gui) error {
+		messageView, err := g.View("messages")
+		if err != nil {
+			return err
+		}
+		// a new buffer always starts at the bottom
+		messageView.Autoscroll = true
+		messageView.Title = title
+		// Update does not guarantee ordering, only redraw once autoscroll is reset
+		gw.redraw()
+		return nil
+	})
+	b.renderTabBar()
+}
+
+func (b *buffers) next() {
+	b.RLock()
+	index := (b.current + 1) % len(b.list)
+	b.RUnlock()
+	b.switchTo(index)
+}
+
+func (b *buffers) previous() {
+	b.RLock()
+	index := (b.current - 1 + len(b.list)) % len(b.list)
+	b.RUnlock()
+	b.switchTo(index)
+}
+
+// closePrivate removes the whisper buffer of nick. The main buffer cannot be closed.
+func (b *buffers) closePrivate(nick string) error {
+	b.Lock()
+	i := b.indexOf(nick)
+	if i == -1 {
+		b.Unlock()
+		return fmt.Errorf("no open whisper buffer for %s", nick)
+	}
+
+	wasActive := i == b.current
+	b.list = append(b.list[:i], b.list[i+1:]...)
+	if b.current >= i {
+		b.current--
+	}
+	current := b.current
+	b.Unlock()
+
+	if wasActive {
+		b.switchTo(current)
+		return nil
+	}
+	b.renderTabBar()
+	return nil
+}
+
+// restyle renders the messages of all buffers and the tab bar again.
+func (b *buffers) restyle() {
+	b.RLock()
+	list := append([]*guiwrapper(nil), b.list...)
+	b.RUnlock()
+
+	for _, gw := range list {
+		gw.restyle()
+	}
+	b.renderTabBar()
+}
+
+func (b *buffers) renderTabBar() {
+	b.RLock()
+	var tabs []string
+	for i, gw := range b.list {
+		gw.RLock()
+		label := fmt.Sprintf(" %d:%s ", i+1, gw.name)
+		if gw.unread > 0 {
+			label = fmt.Sprintf(" %d:%s (%d) ", i+1, gw.name, gw.unread)
+		}
+		switch {
+		case i == b.current:
+			label = fmt.Sprintf("%s%s%s", b.theme.get("tab_current"), label, reset)
+		case gw.unread > 0 && gw.private:
+			label = fmt.Sprintf("%s%s%s", b.theme.get("tab_whisper"), label, reset)
+		case gw.unread > 0:
+			label = fmt.Sprintf("%s%s%s", b.theme.get("tab_unread"), label, reset)
+		}
+		gw.RUnlock()
+		tabs = append(tabs, label)
+	}
+	b.RUnlock()
+
+	b.gui.Update(func(g *gocui.Gui) error {
+		tabView, err := g.View("tabs")
+		if err != nil {
+			return err
+		}
+		tabView.Clear()
+		fmt.Fprint(tabView, strings.Join(tabs, " "))
+		return nil
+	})
+}
+
+func (c *chat) nextBuffer(g *gocui.Gui, v *gocui.View) error {
+	c.buffers.next()
+	return nil
+}
+
+func (c *chat) previousBuffer(g *gocui.Gui, v *gocui.View) error {
+	c.buffers.previous()
+	return nil
+}
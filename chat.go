@@ -1,205 +1,170 @@
 package main
 
 import (
-	"net/url"
+	"os"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/MemeLabs/dggchat"
-	"github.com/awesome-gocui/gocui"
 )
 
-const maxChatHistory = 10
-
 type chat struct {
-	config     *config
-	username   string
-	Session    *dggchat.Session
-	emotes     []string
+	config   *config
+	username string
+	Session  session
+	// builtin commands, a copy of the commands table. Handlers use this one,
+	// referring to the table from its own handlers is an initialization cycle.
+	commands   map[string]command
+	emotes     []string // sorted
 	guiwrapper *guiwrapper
+	buffers    *buffers
+	chatlog    *chatlog
+	history    *historyLoader
+	status     *status
+	theme      *theme
+	flairs     map[string]flairStyle
+	notifier   *notifier
+	headless   *headless
+	plugins    *pluginHost
 
 	helpactive     bool
 	debugActive    bool
 	userListActive bool
 
-	messageHistory []string
+	messageHistory []string // newest first
 	historyIndex   int
+	historyFile    string
+	historySize    int
+	historySearch  *historySearch
 
-	lastSuggestions []string
-	tabIndex        int
-}
+	completion *completion
 
-func newChat(config *config, g *gocui.Gui) (*chat, error) {
-	sgg, err := dggchat.New(";jwt=" + config.AuthToken)
-	if err != nil {
-		return nil, err
-	}
+	emoteSet       map[string]bool
+	emoteModifiers map[string]bool
+	emoteMu        sync.RWMutex
 
-	if config.CustomURL != "" {
-		url, err := url.Parse(config.CustomURL)
-		if err != nil {
-			return nil, err
-		}
-		sgg.SetURL(*url)
-	}
+	input    *inputEditor
+	links    *linkList
+	terminal *terminalWriter
 
-	chat := &chat{
-		config:         config,
-		messageHistory: []string{},
-		historyIndex:   -1,
-		tabIndex:       -1,
-		emotes:         make([]string, 0),
-		username:       config.Username,
-		Session:        sgg,
-		guiwrapper: &guiwrapper{
-			gui:        g,
-			messages:   []*guimessage{},
-			maxlines:   config.Maxlines,
-			timeformat: config.Timeformat,
-		},
-	}
+	selection *selection
+	menu      *contextMenu
 
-	// don't wait for emotes to load
+	modLog   *modLog
+	userList []string // nicks in the order of the users view
 
-	go func() {
-		emotes, _ := getEmotes()
-		chat.emotes = emotes
-	}()
+	search *search
 
-	return chat, nil
+	highlights  []*highlightRule
+	highlightMu sync.RWMutex
 }
 
-func (c *chat) handleInput(message string) {
-	var err error
-
-	// ability to send messages starting with "/"
-	if len(message) >= 2 && message[:2] == "//" {
-		err = c.Session.SendMessage(message[1:])
-	} else if message[:1] == "/" {
-		err = c.handleCommand(message)
-	} else {
-		err = c.Session.SendMessage(message)
+func newChat(config *config, g updater, sgg session) (*chat, error) {
+	if err := config.legacyHighlight(); err != nil {
+		return nil, err
 	}
-
+	theme, err := newTheme(config.Theme, config.Styles)
 	if err != nil {
-		c.renderError(err.Error())
-		// don't return on error, append message to history
+		return nil, err
 	}
 
-	if len(c.messageHistory) > (maxChatHistory - 1) {
-		c.messageHistory = append([]string{message}, c.messageHistory[:(maxChatHistory-1)]...)
-	} else {
-		c.messageHistory = append([]string{message}, c.messageHistory...)
+	flairs, err := compileFlairs(config.Flairs)
+	if err != nil {
+		return nil, err
 	}
-	c.historyIndex = -1
-	c.tabIndex = -1
-}
 
-func (c *chat) tabComplete(v *gocui.View) {
-	buffer := v.Buffer()
-
-	if buffer == "" {
-		return
+	terminal := &terminalWriter{gui: g, out: os.Stdout}
+	notifier, err := newNotifier(config.Notifications, terminal)
+	if err != nil {
+		return nil, err
 	}
 
-	// strip \n
-	buffer = buffer[:len(buffer)-1]
-	if len(buffer) == 0 {
-		return
+	chat := &chat{
+		config:       config,
+		historyIndex: -1,
+		historyFile:  config.InputHistory,
+		historySize:  config.InputHistorySize,
+		input:        &inputEditor{pasteThreshold: time.Duration(config.PasteThreshold) * time.Millisecond},
+		commands:     commands,
+		links:        &linkList{},
+		terminal:     terminal,
+		modLog:       newModLog(),
+		emotes:       make([]string, 0),
+		username:     config.Username,
+		Session:      sgg,
+		theme:        theme,
+		flairs:       flairs,
+		notifier:     notifier,
+		guiwrapper: &guiwrapper{
+			gui:        g,
+			theme:      theme,
+			name:       "main",
+			messages:   []*guimessage{},
+			maxlines:   config.Maxlines,
+			timeformat: config.Timeformat,
+		},
 	}
+	chat.buffers = newBuffers(g, chat.guiwrapper)
+	// messages arriving while the terminal is in the background are unread
+	chat.input.onFocusLost = func() { chat.buffers.active().markUnread() }
 
-	x, _ := v.Cursor()
-	strSlice := strings.Split(buffer, " ")
-
-	runeIndex := 0
-	var selectedWordIndex int
-
-	for i, word := range strSlice {
-		if i == len(strSlice)-1 {
-			runeIndex++
-		}
-
-		if x >= runeIndex && x <= runeIndex+len(word) {
-			selectedWordIndex = i
-			break
-		}
-		runeIndex += len(word) + 1
+	if chat.historySize <= 0 {
+		chat.historySize = defaultInputHistorySize
 	}
-
-	selectedWord := strSlice[selectedWordIndex]
-
-	if selectedWordIndex != len(strSlice)-1 {
-		// for now just deal with tabbing the last word
-		// tabbing words in the middle of a sentance
-		// is very annoying to implement
-		return
+	chat.messageHistory, err = loadInputHistory(config.InputHistory, chat.historySize)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(selectedWord) < 2 && selectedWord != "" {
-		return
+	chat.plugins, err = newPluginHost(chat, config.Plugins)
+	if err != nil {
+		return nil, err
 	}
 
-	var suggestions []string
-	if c.tabIndex != -1 && c.lastSuggestions[c.tabIndex] == selectedWord {
-		suggestions = c.lastSuggestions
-	} else {
-		suggestions = c.generateSuggestions(selectedWord)
+	if err := chat.compileHighlights(); err != nil {
+		return nil, err
 	}
 
-	if len(suggestions) == 0 {
-		return
-	}
+	chat.status = &status{gui: g, theme: theme, nick: config.Username, dnd: config.Notifications.DoNotDisturb}
+	sgg.SetDialer(chat.status.dialer())
 
-	// movement logic
-	if c.tabIndex < len(suggestions)-1 {
-		c.tabIndex++
-	} else {
-		c.tabIndex = 0
+	if config.LoadHistory {
+		chat.history = newHistoryLoader(config.HistoryURL)
 	}
 
-	c.lastSuggestions = suggestions
-	suggestion := suggestions[c.tabIndex]
-	strSlice[selectedWordIndex] = suggestion
-	newBuffer := []byte(strings.Join(strSlice, " "))
-
-	newCursor := len(newBuffer) + 1
-	// for i, word := range strSlice {
-	// 	if i <= selectedWordIndex {
-	// 		newCursor += len(word) + 1
-	// 	}
-	// }
-
-	v.Clear()
-	v.SetOrigin(0, 0)
-	v.Write(newBuffer)
-	v.SetCursor(newCursor, 0)
+	return chat, nil
 }
 
-func (c *chat) generateSuggestions(s string) []string {
-	users := c.Session.GetUsers()
-	suggestions := make([]string, 0)
-
-	nameSlice := make([]string, 0)
-
-	for _, user := range users {
-		nameSlice = append(nameSlice, user.Nick)
+func (c *chat) handleInput(message string) {
+	err := c.dispatch(message, 0)
+	if err != nil {
+		c.renderError(err.Error())
+		// don't return on error, append message to history
 	}
 
-	nameSlice = append(nameSlice, c.emotes...)
+	c.rememberInput(message)
+	c.completion = nil
+}
 
-	// add commands to suggestions
-	for cmd := range commands {
-		nameSlice = append(nameSlice, cmd)
-	}
+// dispatch sends a message or runs a command, depth counts the aliases it was expanded from.
+func (c *chat) dispatch(message string, depth int) error {
+	// inside a whisper buffer, plain input is whispered to the conversation partner
+	nick, private := c.buffers.privateTarget()
 
-	for _, name := range nameSlice {
-		if strings.HasPrefix(strings.ToLower(name), strings.ToLower(s)) {
-			suggestions = append(suggestions, name)
+	// ability to send messages starting with "/"
+	if len(message) >= 2 && message[:2] == "//" {
+		if private {
+			return sendWhisper(c, []string{"/w", nick, message[1:]})
 		}
+		return c.Session.SendMessage(message[1:])
+	} else if message[:1] == "/" {
+		return c.handleCommand(message, depth)
+	} else if private {
+		return sendWhisper(c, []string{"/w", nick, message})
 	}
-
-	sort.Strings(suggestions)
-	return suggestions
+	return c.Session.SendMessage(message)
 }
 
 func (c *chat) sortUsers(u []dggchat.User) {
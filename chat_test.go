@@ -0,0 +1,254 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+func testConfig() *config {
+	return &config{
+		Username:        "tester",
+		Timeformat:      time.Kitchen,
+		Maxlines:        100,
+		ScrollingSpeed:  1,
+		PageUpDownSpeed: 10,
+	}
+}
+
+// newTestChat creates a chat without a terminal, tests check the buffers
+// instead of the views.
+func newTestChat(t *testing.T, cfg *config, s session) *chat {
+	t.Helper()
+	c, err := newChat(cfg, noGui{}, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.addHandlers()
+	return c
+}
+
+// lines returns the messages of gw without colors.
+func lines(gw *guiwrapper) []string {
+	gw.RLock()
+	defer gw.RUnlock()
+	l := make([]string, 0, len(gw.messages))
+	for _, m := range gw.messages {
+		l = append(l, stripANSI(m.msg))
+	}
+	return l
+}
+
+func TestHandleInput(t *testing.T) {
+	tests := []struct {
+		input string
+		sent  []string
+	}{
+		{"hello there", []string{"MSG hello there"}},
+		{"//not a command", []string{"MSG /not a command"}},
+		{"/me waves", []string{"MSG /me waves"}},
+		{"/w bob hi bob", []string{"PRIVMSG bob hi bob"}},
+		{"/mute bob 60", []string{"MUTE bob 1m0s"}},
+		{"/ban bob spam 10", []string{`BAN bob "spam" 10s ip=false`}},
+		{"/permip bob spam", []string{`BAN bob "spam" permanent ip=true`}},
+		{"/mute bob 10m", []string{"MUTE bob 10m0s"}},
+		{`/ban bob "spamming links" 1d`, []string{`BAN bob "spamming links" 24h0m0s ip=false`}},
+		{"/ban --ip bob spamming links 2h", []string{`BAN bob "spamming links" 2h0m0s ip=true`}},
+		{"/ban bob spam", []string{`BAN bob "spam" 0s ip=false`}},
+		{"/perm --ip bob very rude", []string{`BAN bob "very rude" permanent ip=true`}},
+		{"/ban bob don't spam 1d", []string{`BAN bob "don't spam" 24h0m0s ip=false`}},
+		{"/ban bob  stop it,  you're  spamming", []string{`BAN bob "stop it,  you're  spamming" 0s ip=false`}},
+		{`/ban bob "banned for 10" `, []string{`BAN bob "banned for 10" 0s ip=false`}},
+		{"/ipban bob it's a \"bot\" 2h", []string{`BAN bob "it's a \"bot\"" 2h0m0s ip=true`}},
+		{"/perm bob he's a bot", []string{`BAN bob "he's a bot" permanent ip=false`}},
+		{"/permip bob 'quoted reason'", []string{`BAN bob "quoted reason" permanent ip=true`}},
+		{"/w bob don't", []string{"PRIVMSG bob don't"}},
+		{`/w bob  "quoted"  text`, []string{`PRIVMSG bob "quoted"  text`}},
+		{`/ban bob "unterminated`, []string{}},
+		{"/subonly", []string{}},
+		{"/subonly on", []string{"SUBONLY true"}},
+		{"/unknown", []string{}},
+		{"/w bob", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			s := &fakeSession{}
+			c := newTestChat(t, testConfig(), s)
+			c.handleInput(tt.input)
+
+			if sent := s.messages(); !reflect.DeepEqual(sent, tt.sent) {
+				t.Errorf("sent %q, want %q", sent, tt.sent)
+			}
+			if c.messageHistory[0] != tt.input {
+				t.Errorf("input history starts with %q, want %q", c.messageHistory[0], tt.input)
+			}
+		})
+	}
+}
+
+func TestHandleInputErrors(t *testing.T) {
+	s := &fakeSession{err: errors.New("connection not established")}
+	c := newTestChat(t, testConfig(), s)
+
+	c.handleInput("hello")
+	c.handleInput("/unknown")
+
+	got := lines(c.guiwrapper)
+	want := []string{
+		"*Error sending message: connection not established*",
+		"*Error sending message: unknown command: /unknown*",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rendered %q, want %q", got, want)
+	}
+}
+
+func TestHandleInputPrivateBuffer(t *testing.T) {
+	s := &fakeSession{}
+	c := newTestChat(t, testConfig(), s)
+
+	c.buffers.showPrivate("bob")
+	c.handleInput("psst")
+	c.handleInput("//w not a command")
+
+	want := []string{"PRIVMSG bob psst", "PRIVMSG bob /w not a command"}
+	if sent := s.messages(); !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent %q, want %q", sent, want)
+	}
+	if got := lines(c.buffers.private("bob")); len(got) != 2 {
+		t.Errorf("private buffer has %d messages, want 2: %q", len(got), got)
+	}
+	if got := lines(c.guiwrapper); len(got) != 0 {
+		t.Errorf("main buffer has messages: %q", got)
+	}
+}
+
+func TestRenderMessage(t *testing.T) {
+	cfg := testConfig()
+	cfg.Ignores = []string{"troll"}
+	cfg.Highlighted = []string{"tsgg"}
+	s := &fakeSession{}
+	c := newTestChat(t, cfg, s)
+
+	msg := func(nick, text string) {
+		s.onMessage(dggchat.Message{Sender: dggchat.User{Nick: nick}, Timestamp: time.Now(), Message: text}, nil)
+	}
+	msg("bob", "hi")
+	msg("Troll", "ignore me")
+	msg("bob", "tsgg is neat")
+	msg("bob", "tsggs are not highlighted")
+	msg("bob", ">implying")
+
+	got := lines(c.guiwrapper)
+	want := []string{"bob: hi", "bob: tsgg is neat", "bob: tsggs are not highlighted", "bob: >implying"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("rendered %q, want %q", got, want)
+	}
+
+	c.guiwrapper.RLock()
+	defer c.guiwrapper.RUnlock()
+	highlight := string(c.theme.get("highlight"))
+	if !strings.Contains(c.guiwrapper.messages[1].msg, highlight+"tsgg is neat") {
+		t.Errorf("highlighted message not styled: %q", c.guiwrapper.messages[1].msg)
+	}
+	if strings.Contains(c.guiwrapper.messages[2].msg, highlight) {
+		t.Errorf("partial word highlighted: %q", c.guiwrapper.messages[2].msg)
+	}
+	if greentext := string(c.theme.get("greentext")); !strings.Contains(c.guiwrapper.messages[3].msg, greentext+">implying") {
+		t.Errorf("greentext not styled: %q", c.guiwrapper.messages[3].msg)
+	}
+}
+
+func TestRenderPrivateMessage(t *testing.T) {
+	s := &fakeSession{}
+	c := newTestChat(t, testConfig(), s)
+
+	s.onPM(dggchat.PrivateMessage{User: dggchat.User{Nick: "bob"}, Message: "secret", Timestamp: time.Now()}, nil)
+
+	want := []string{"[PM <- bob] secret "}
+	if got := lines(c.buffers.private("bob")); !reflect.DeepEqual(got, want) {
+		t.Errorf("rendered %q, want %q", got, want)
+	}
+	if c.buffers.private("bob").unread != 1 {
+		t.Errorf("whisper buffer not marked unread")
+	}
+}
+
+func TestUnhighlight(t *testing.T) {
+	defer func(f string) { configFile = f }(configFile)
+	configFile = filepath.Join(t.TempDir(), "config.toml")
+
+	cfg := testConfig()
+	cfg.HighlightRules = []highlightRule{{Pattern: "one"}, {Pattern: "two"}, {Pattern: "three", Type: highlightRegex}}
+	c := newTestChat(t, cfg, &fakeSession{})
+
+	c.handleInput("/unhighlight one")
+	c.handleInput("/highlight two")
+
+	c.highlightMu.RLock()
+	var got []string
+	for _, r := range c.highlights {
+		got = append(got, r.String())
+	}
+	c.highlightMu.RUnlock()
+	want := []string{"tester (word)", "two (word)", "three (regex)"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("highlights %q, want %q", got, want)
+	}
+	if n := countLines(c.guiwrapper, "two is already highlighted"); n != 1 {
+		t.Errorf("duplicate rule not rejected: %q", lines(c.guiwrapper))
+	}
+}
+
+func TestSwitchTheme(t *testing.T) {
+	defer func(f string) { configFile = f }(configFile)
+	configFile = filepath.Join(t.TempDir(), "config.toml")
+
+	cfg := testConfig()
+	cfg.Highlighted = []string{"tsgg"}
+	s := &fakeSession{}
+	c := newTestChat(t, cfg, s)
+
+	s.onMessage(dggchat.Message{Sender: dggchat.User{Nick: "bob"}, Timestamp: time.Now(), Message: "tsgg is neat"}, nil)
+	s.onPM(dggchat.PrivateMessage{User: dggchat.User{Nick: "bob"}, Message: "secret", Timestamp: time.Now()}, nil)
+	c.handleInput("/theme pastel")
+
+	c.guiwrapper.RLock()
+	msg := c.guiwrapper.messages[0].msg
+	c.guiwrapper.RUnlock()
+	if highlight := string(c.theme.get("highlight")); !strings.Contains(msg, highlight+"tsgg is neat") {
+		t.Errorf("old message keeps the previous theme: %q", msg)
+	}
+
+	pm := c.buffers.private("bob")
+	pm.RLock()
+	msg = pm.messages[0].msg
+	pm.RUnlock()
+	if style := string(c.theme.get("pm")); !strings.HasPrefix(msg, style) {
+		t.Errorf("old whisper keeps the previous theme: %q", msg)
+	}
+}
+
+func TestLegacyHighlightColors(t *testing.T) {
+	cfg := testConfig()
+	cfg.HighlightBg = "\u001b[47m"
+	cfg.HighlightFg = "\u001b[30;1m"
+	c := newTestChat(t, cfg, &fakeSession{})
+
+	want, _ := parseStyle("on white black bold")
+	if got := c.theme.get("highlight"); got != want {
+		t.Errorf("highlight style %q, want %q", got, want)
+	}
+
+	cfg = testConfig()
+	cfg.HighlightBg = "white"
+	if _, err := newChat(cfg, noGui{}, &fakeSession{}); err == nil {
+		t.Errorf("highlight_bg_color without escape sequence accepted")
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+// used when no custom_url is configured, mirrors the dggchat default.
+const defaultChannel = "www.destiny.gg"
+
+// chatlog writes received events to disk, one directory per channel and one
+// file per day. Plain text is always written, JSON Lines only if enabled.
+type chatlog struct {
+	dir     string
+	json    bool
+	day     string
+	text    *os.File
+	jsonl   *os.File
+	lastErr error
+	sync.Mutex
+}
+
+type logEntry struct {
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	Nick      string    `json:"nick,omitempty"`
+	Features  []string  `json:"features,omitempty"`
+	Target    string    `json:"target,omitempty"`
+	Data      string    `json:"data,omitempty"`
+}
+
+func newChatlog(dir string, channelURL string, jsonLines bool) (*chatlog, error) {
+	channel := defaultChannel
+	if channelURL != "" {
+		u, err := url.Parse(channelURL)
+		if err != nil {
+			return nil, err
+		}
+		channel = u.Host + u.Path
+	}
+
+	// turn "chat.strims.gg/ws" into a single safe directory name
+	channel = strings.Trim(strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' {
+			return '_'
+		}
+		return r
+	}, channel), "_")
+
+	dir = filepath.Join(dir, channel)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("error creating log directory: %v", err)
+	}
+
+	return &chatlog{dir: dir, json: jsonLines}, nil
+}
+
+// rotate makes sure the files for the day of ts are open. Call with lock held.
+func (l *chatlog) rotate(ts time.Time) error {
+	day := ts.Format("2006-01-02")
+	if day == l.day && l.text != nil {
+		return nil
+	}
+	l.closeFiles()
+
+	var err error
+	l.text, err = openLogFile(filepath.Join(l.dir, day+".log"))
+	if err != nil {
+		return err
+	}
+	if l.json {
+		l.jsonl, err = openLogFile(filepath.Join(l.dir, day+".jsonl"))
+		if err != nil {
+			return err
+		}
+	}
+	l.day = day
+	return nil
+}
+
+func openLogFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening log file: %v", err)
+	}
+	return f, nil
+}
+
+// write only returns the first error of a series of failed writes, so a full
+// disk does not flood the debug view.
+func (l *chatlog) write(e logEntry) error {
+	l.Lock()
+	defer l.Unlock()
+
+	err := l.writeEntry(e)
+	if err != nil && l.lastErr != nil {
+		l.lastErr = err
+		return nil
+	}
+	l.lastErr = err
+	return err
+}
+
+// call with lock held
+func (l *chatlog) writeEntry(e logEntry) error {
+	// backfilled history goes to the day it happened
+	ts := e.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	if err := l.rotate(ts); err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintln(l.text, formatLogEntry(e)); err != nil {
+		return err
+	}
+
+	if l.jsonl != nil {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if _, err := l.jsonl.Write(append(b, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatLogEntry(e logEntry) string {
+	ts := e.Timestamp.Format("2006-01-02 15:04:05")
+	switch e.Type {
+	case "MSG":
+		return fmt.Sprintf("[%s] %s: %s", ts, e.Nick, e.Data)
+	case "PRIVMSG":
+		return fmt.Sprintf("[%s] [PM <- %s] %s", ts, e.Nick, e.Data)
+	case "PRIVMSGSENT":
+		return fmt.Sprintf("[%s] [PM -> %s] %s", ts, e.Target, e.Data)
+	case "BROADCAST":
+		return fmt.Sprintf("[%s] BROADCAST %s", ts, e.Data)
+	case "JOIN":
+		return fmt.Sprintf("[%s] %s joined", ts, e.Nick)
+	case "QUIT":
+		return fmt.Sprintf("[%s] %s left", ts, e.Nick)
+	case "MUTE", "UNMUTE", "BAN", "UNBAN":
+		return fmt.Sprintf("[%s] %s %sd by %s", ts, e.Target, strings.ToLower(e.Type), e.Nick)
+	case "SUBONLY":
+		return fmt.Sprintf("[%s] %s changed subonly mode to: %s", ts, e.Nick, e.Data)
+	}
+	return fmt.Sprintf("[%s] %s %s %s", ts, e.Type, e.Nick, e.Data)
+}
+
+// call with lock held
+func (l *chatlog) closeFiles() {
+	if l.text != nil {
+		l.text.Close()
+		l.text = nil
+	}
+	if l.jsonl != nil {
+		l.jsonl.Close()
+		l.jsonl = nil
+	}
+}
+
+func (l *chatlog) close() {
+	l.Lock()
+	defer l.Unlock()
+	l.closeFiles()
+}
+
+// logEvent writes e to the chat log if logging is enabled, prints it when
+// running headless and forwards it to plugins.
+func (c *chat) logEvent(e logEntry) {
+	c.printEvent(e)
+	c.plugins.event(e)
+	if c.chatlog == nil {
+		return
+	}
+
+	if err := c.chatlog.write(e); err != nil {
+		c.renderDebug(fmt.Sprintf("chat log: %v", err))
+	}
+}
+
+func messageEntry(m dggchat.Message) logEntry {
+	return logEntry{Type: "MSG", Timestamp: m.Timestamp, Nick: m.Sender.Nick, Features: m.Sender.Features, Data: m.Message}
+}
+
+func privateMessageEntry(pm dggchat.PrivateMessage) logEntry {
+	return logEntry{Type: "PRIVMSG", Timestamp: pm.Timestamp, Nick: pm.User.Nick, Data: pm.Message}
+}
+
+func muteEntry(t string, m dggchat.Mute) logEntry {
+	return logEntry{Type: t, Timestamp: m.Timestamp, Nick: m.Sender.Nick, Target: m.Target.Nick}
+}
+
+func banEntry(t string, b dggchat.Ban) logEntry {
+	return logEntry{Type: t, Timestamp: b.Timestamp, Nick: b.Sender.Nick, Target: b.Target.Nick}
+}
+
+func roomActionEntry(t string, r dggchat.RoomAction) logEntry {
+	return logEntry{Type: t, Timestamp: r.Timestamp, Nick: r.User.Nick}
+}
+
+func broadcastEntry(b dggchat.Broadcast) logEntry {
+	return logEntry{Type: "BROADCAST", Timestamp: b.Timestamp, Nick: b.Sender.Nick, Data: b.Message}
+}
+
+func subOnlyEntry(so dggchat.SubOnly) logEntry {
+	data := "off"
+	if so.Active {
+		data = "on"
+	}
+	return logEntry{Type: "SUBONLY", Timestamp: so.Timestamp, Nick: so.Sender.Nick, Data: data}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestChatlogDays(t *testing.T) {
+	l, err := newChatlog(t.TempDir(), "wss://chat.strims.gg/ws", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.close()
+
+	midnight := time.Date(2020, 5, 2, 0, 0, 0, 0, time.Local)
+	entries := []logEntry{
+		{Type: "MSG", Timestamp: midnight.Add(time.Minute), Nick: "bob", Data: "after midnight"},
+		// backfilled after the first message of the new day
+		{Type: "MSG", Timestamp: midnight.Add(-time.Minute), Nick: "bob", Data: "before midnight"},
+	}
+	for _, e := range entries {
+		if err := l.write(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.close()
+
+	for day, want := range map[string]string{
+		"2020-05-01.log": formatLogEntry(entries[1]) + "\n",
+		"2020-05-02.log": formatLogEntry(entries[0]) + "\n",
+	} {
+		got, err := ioutil.ReadFile(filepath.Join(l.dir, day))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s contains %q, want %q", day, got, want)
+		}
+	}
+}
@@ -3,111 +3,273 @@ package main
 import (
 	"errors"
 	"fmt"
-	"strconv"
 	"strings"
 	"time"
 )
 
+// kinds of the first argument of a command, flags like --ip don't count
+type argKind int
+
+const (
+	argOther argKind = iota
+	argUser
+)
+
 type command struct {
 	c          func(*chat, []string) error
 	usage      string
+	arg        argKind // what tab completes as the first argument
 	privileged bool
+	// tokens, counting the command, before free text like a message which
+	// is passed on verbatim as the last token. 0 parses every argument.
+	text int
 }
 
 // TODO need to refactor this... usage strings incomplete/double
 var commands = map[string]command{
-	"/w":           {sendWhisper, "user message", false},
-	"/whisper":     {sendWhisper, "user message", false},
-	"/me":          {sendAction, "message", false},
-	"/tag":         {addTag, "user color", false},
-	"/untag":       {removeTag, "user", false},
-	"/highlight":   {addHighlight, "user", false},
-	"/unhighlight": {removeHighlight, "user", false},
-	"/ignore":      {addIgnore, "user", false},
-	"/unignore":    {removeIgnore, "user", false},
-	"/stalk":       {addStalk, "user", false},
-	"/unstalk":     {removeStalk, "user", false},
-	"/mute":        {sendMute, "user [time (in seconds)]", true},
-	"/unmute":      {sendUnmute, "user", true},
-	// TODO reason is forced to be single string here without good reason.
-	"/ban":       {sendBan, "user reason [time (in seconds)]", true},
-	"/ipban":     {sendBan, "user reason [time (in seconds)]", true},
-	"/perm":      {sendPermBan, "user reason", true},
-	"/permip":    {sendPermBan, "user reason", true},
-	"/unban":     {sendUnban, "user", true},
-	"/subonly":   {sendSubOnly, "{on,off}", true},
-	"/broadcast": {sendBroadcast, "message", true},
+	"/w":           {sendWhisper, "user message", argUser, false, 2},
+	"/whisper":     {sendWhisper, "user message", argUser, false, 2},
+	"/query":       {openQuery, "user", argUser, false, 0},
+	"/close":       {closeQuery, "[user]", argUser, false, 0},
+	"/me":          {sendAction, "message", argOther, false, 1},
+	"/theme":       {setTheme, "[name]", argOther, false, 0},
+	"/tag":         {addTag, "user color", argUser, false, 0},
+	"/untag":       {removeTag, "user", argUser, false, 0},
+	"/highlight":   {addHighlight, "[--regex|--nick] [--fg color] [--bg color] [--notify] pattern", argOther, false, 0},
+	"/unhighlight": {removeHighlight, "pattern", argOther, false, 0},
+	"/ignore":      {addIgnore, "user", argUser, false, 0},
+	"/unignore":    {removeIgnore, "user", argUser, false, 0},
+	"/stalk":       {addStalk, "user", argUser, false, 0},
+	"/unstalk":     {removeStalk, "user", argUser, false, 0},
+	"/dnd":         {toggleDND, "[on|off]", argOther, false, 0},
+	"/plugins":     {listPlugins, "", argOther, false, 0},
+	"/emotes":      {listEmotes, "[filter]", argOther, false, 0},
+	"/open":        {openLinkCommand, "[link number]", argOther, false, 0},
+	"/copy":        {copyLinkCommand, "[link number]", argOther, false, 0},
+	"/history":     {showUserHistory, "user [count]", argUser, false, 0},
+	"/alias":       {addAlias, "[name [command; command...]]", argOther, false, 2},
+	"/unalias":     {removeAlias, "name", argOther, false, 0},
+	"/mute":        {sendMute, "user [duration, e.g. 600, 10m, 2h, 1d]", argUser, true, 0},
+	"/unmute":      {sendUnmute, "user", argUser, true, 0},
+	"/ban":         {sendBan, "[--ip] user reason [duration]", argUser, true, 2},
+	"/ipban":       {sendBan, "user reason [duration]", argUser, true, 2},
+	"/perm":        {sendPermBan, "[--ip] user reason", argUser, true, 2},
+	"/permip":      {sendPermBan, "user reason", argUser, true, 2},
+	"/unban":       {sendUnban, "user", argUser, true, 0},
+	"/subonly":     {sendSubOnly, "{on,off}", argOther, true, 0},
+	"/broadcast":   {sendBroadcast, "message", argOther, true, 1},
 }
 
-// translate user tags into colors...
-var tagMap = map[string]color{
-	"black":   bgBlack,
-	"red":     bgRed,
-	"green":   bgGreen,
-	"yellow":  bgYellow,
-	"blue":    bgBlue,
-	"magenta": bgMagenta,
-	"cyan":    bgCyan,
-	"white":   bgWhite,
-}
+// colors of user tags, see tagStyle
+var tagColors = []string{"black", "blue", "cyan", "green", "magenta", "red", "white", "yellow"}
 
-func (c *chat) handleCommand(message string) error {
-	s := strings.Split(message, " ")
+func (c *chat) handleCommand(message string, depth int) error {
+	name := strings.Fields(message)[0]
+	s, err := parseArgs(message, c.commands[name].text)
+	if err != nil {
+		return err
+	}
+
+	if alias, ok := c.alias(s[0]); ok {
+		return c.runAlias(alias, s, depth)
+	}
 
-	f, ok := commands[s[0]]
+	f, ok := c.commands[s[0]]
 	if ok {
+		if f.privileged {
+			if err := c.checkPrivileged(s[0]); err != nil {
+				return err
+			}
+		}
 		return f.c(c, s)
 	}
 
+	if p, ok := c.plugins.command(s[0]); ok {
+		c.plugins.runCommand(p, s)
+		return nil
+	}
+
 	return fmt.Errorf("unknown command: %s", s[0])
 }
 
 func addHighlight(c *chat, tokens []string) error {
-	if len(tokens) < 2 {
-		return errors.New("usage: /highlight user")
+	usage := errors.New("usage: /highlight [--regex|--nick] [--fg color] [--bg color] [--notify] pattern")
+
+	if len(tokens) == 1 {
+		c.highlightMu.RLock()
+		rules := make([]string, 0, len(c.highlights))
+		for _, r := range c.highlights {
+			rules = append(rules, r.String())
+		}
+		c.highlightMu.RUnlock()
+		c.renderCommand(fmt.Sprintf("Highlighting: %s", strings.Join(rules, ", ")))
+		return nil
 	}
 
-	user := strings.ToLower(tokens[1])
-	if contains(c.config.Highlighted, user) {
-		return fmt.Errorf("%s is already highlighted", user)
+	rule := highlightRule{Type: highlightWord}
+	var pattern []string
+	for i := 1; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "--regex", "-r":
+			rule.Type = highlightRegex
+		case "--nick", "-n":
+			rule.Type = highlightNick
+		case "--notify":
+			rule.Notify = true
+		case "--fg", "--bg":
+			if i+1 >= len(tokens) {
+				return usage
+			}
+			if tokens[i] == "--fg" {
+				rule.Fg = strings.ToLower(tokens[i+1])
+			} else {
+				rule.Bg = strings.ToLower(tokens[i+1])
+			}
+			i++
+		default:
+			pattern = append(pattern, tokens[i])
+		}
+	}
+
+	rule.Pattern = strings.Join(pattern, " ")
+	if rule.Pattern == "" {
+		return usage
+	}
+	if err := rule.compile(); err != nil {
+		return err
 	}
 
 	c.config.Lock()
-	c.config.Highlighted = append(c.config.Highlighted, user)
+	for _, r := range c.config.HighlightRules {
+		// rules from the config file may leave out the default type
+		if (r.Type == rule.Type || r.Type == "" && rule.Type == highlightWord) && strings.EqualFold(r.Pattern, rule.Pattern) {
+			c.config.Unlock()
+			return fmt.Errorf("%s is already highlighted", rule.Pattern)
+		}
+	}
+	c.config.HighlightRules = append(c.config.HighlightRules, rule)
 	c.config.Unlock()
 
 	err := c.config.save()
 	if err != nil {
 		return err
 	}
-	msg := fmt.Sprintf("Highlighted %s", user)
+	if err := c.compileHighlights(); err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("Highlighted %s", rule.String())
 	c.renderCommand(msg)
 	return nil
 }
 
 func removeHighlight(c *chat, tokens []string) error {
 	if len(tokens) < 2 {
-		return errors.New("usage: /unhighlight user")
+		return errors.New("usage: /unhighlight pattern")
 	}
 
-	user := strings.ToLower(tokens[1])
-	c.config.Lock()
-	defer c.config.Unlock()
+	pattern := strings.Join(tokens[1:], " ")
+	removed := false
 
+	c.config.Lock()
 	for i := 0; i < len(c.config.Highlighted); i++ {
-		if strings.ToLower(c.config.Highlighted[i]) == user {
+		if strings.EqualFold(c.config.Highlighted[i], pattern) {
 			c.config.Highlighted = append(c.config.Highlighted[:i], c.config.Highlighted[i+1:]...)
-			err := c.config.save()
-			if err != nil {
-				return err
-			}
-			msg := fmt.Sprintf("Unhighlighted %s", user)
-			c.renderCommand(msg)
-			return nil
+			removed = true
+			break
+		}
+	}
+	for i := 0; i < len(c.config.HighlightRules); i++ {
+		if strings.EqualFold(c.config.HighlightRules[i].Pattern, pattern) {
+			c.config.HighlightRules = append(c.config.HighlightRules[:i], c.config.HighlightRules[i+1:]...)
+			removed = true
+			break
 		}
 	}
+	c.config.Unlock()
+
+	if !removed {
+		return fmt.Errorf("%s is not in highlight list", pattern)
+	}
+
+	err := c.config.save()
+	if err != nil {
+		return err
+	}
+	if err := c.compileHighlights(); err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("Unhighlighted %s", pattern)
+	c.renderCommand(msg)
+	return nil
+}
+
+func setTheme(c *chat, tokens []string) error {
+	if len(tokens) > 2 {
+		return errors.New("usage: /theme [name]")
+	}
+
+	if len(tokens) == 1 {
+		msg := fmt.Sprintf("Current theme: %s, available themes: %s", c.theme.current(), strings.Join(themeNames(), ", "))
+		c.renderCommand(msg)
+		return nil
+	}
+
+	name := strings.ToLower(tokens[1])
+	c.config.RLock()
+	err := c.theme.load(name, c.config.Styles)
+	c.config.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	c.config.Lock()
+	c.config.Theme = name
+	c.config.Unlock()
+
+	err = c.config.save()
+	if err != nil {
+		return err
+	}
 
-	return fmt.Errorf("%s is not in highlight list", user)
+	c.buffers.restyle()
+	c.renderUsers(c.Session.GetUsers())
+	c.status.render()
+	msg := fmt.Sprintf("Switched to theme %s", name)
+	c.renderCommand(msg)
+	return nil
+}
+
+// toggleDND toggles do not disturb, which silences all notifications.
+func toggleDND(c *chat, tokens []string) error {
+	c.config.Lock()
+	dnd := !c.config.Notifications.DoNotDisturb
+	if len(tokens) > 1 {
+		switch tokens[1] {
+		case "on":
+			dnd = true
+		case "off":
+			dnd = false
+		default:
+			c.config.Unlock()
+			return errors.New("usage: /dnd [on|off]")
+		}
+	}
+	c.config.Notifications.DoNotDisturb = dnd
+	c.config.Unlock()
+
+	err := c.config.save()
+	if err != nil {
+		return err
+	}
+
+	c.notifier.setDND(dnd)
+	c.status.setDND(dnd)
+	if dnd {
+		c.renderCommand("Do not disturb enabled, notifications are silenced")
+	} else {
+		c.renderCommand("Do not disturb disabled")
+	}
+	return nil
 }
 
 func addStalk(c *chat, tokens []string) error {
@@ -166,8 +328,7 @@ func addTag(c *chat, tokens []string) error {
 	color := strings.ToLower(tokens[2])
 	user := strings.ToLower(tokens[1])
 
-	newcolor, ok := tagMap[color]
-	if !ok {
+	if indexOf(tagColors, color) == -1 {
 		return fmt.Errorf("invalid color: %s", color)
 	}
 
@@ -183,8 +344,7 @@ func addTag(c *chat, tokens []string) error {
 		return err
 	}
 
-	newTag := fmt.Sprintf("%s   %s", newcolor, reset)
-	c.guiwrapper.applyTag(newTag, user)
+	c.guiwrapper.restyle()
 	msg := fmt.Sprintf("Tagged %s", user)
 	c.renderCommand(msg)
 	return nil
@@ -198,40 +358,43 @@ func removeTag(c *chat, tokens []string) error {
 	user := strings.ToLower(tokens[1])
 
 	c.config.Lock()
-	defer c.config.Unlock()
-
-	if _, ok := c.config.Tags[user]; ok {
-		delete(c.config.Tags, user)
-		err := c.config.save()
-		if err != nil {
-			return err
-		}
-		newTag := fmt.Sprintf("%s   %s", none, reset)
-		c.guiwrapper.applyTag(newTag, user)
-		msg := fmt.Sprintf("Untagged %s", user)
-		c.renderCommand(msg)
-		return nil
+	_, ok := c.config.Tags[user]
+	delete(c.config.Tags, user)
+	c.config.Unlock()
+	if !ok {
+		return fmt.Errorf("%s is not tagged", user)
 	}
 
-	return fmt.Errorf("%s is not tagged", user)
+	err := c.config.save()
+	if err != nil {
+		return err
+	}
+	c.guiwrapper.restyle()
+	msg := fmt.Sprintf("Untagged %s", user)
+	c.renderCommand(msg)
+	return nil
 }
 
 func sendMute(c *chat, tokens []string) error {
 	if len(tokens) < 2 || len(tokens) > 3 {
-		return errors.New("usage: /mute user [time in seconds]")
+		return errors.New("usage: /mute user [duration, e.g. 600, 10m, 2h, 1d]")
 	}
 
 	var err error
-	var duration int64 // server chooses default duration
+	var duration time.Duration // server chooses default duration
 
 	if len(tokens) >= 3 {
-		duration, err = strconv.ParseInt(strings.TrimSpace(tokens[2]), 10, 64)
+		duration, err = parseDuration(tokens[2])
 		if err != nil {
 			return err
 		}
 	}
 
-	return c.Session.SendMute(tokens[1], time.Duration(duration)*time.Second)
+	if err := c.Session.SendMute(tokens[1], duration); err != nil {
+		return err
+	}
+	c.modLog.expect(modAction{kind: "mute", target: tokens[1], duration: duration})
+	return nil
 }
 
 func sendUnmute(c *chat, tokens []string) error {
@@ -242,23 +405,53 @@ func sendUnmute(c *chat, tokens []string) error {
 	return c.Session.SendUnmute(tokens[1])
 }
 
-func sendBan(c *chat, tokens []string) error {
-	if len(tokens) < 3 || len(tokens) > 4 {
-		return errors.New("usage: /[ip]ban user reason [time (in seconds)]")
+// banReason splits the free text of a ban into the reason and the duration
+// at its end. The reason is passed on verbatim unless it is quoted, which
+// keeps a reason ending in something that looks like a duration intact.
+func banReason(text string) (reason string, duration time.Duration, err error) {
+	if strings.HasPrefix(text, `"`) || strings.HasPrefix(text, "'") {
+		reason, rest, _, err := nextArg(text)
+		if err != nil {
+			return "", 0, err
+		}
+		if rest = strings.TrimSpace(rest); rest == "" {
+			return reason, 0, nil
+		}
+		if duration, err := parseDuration(rest); err == nil {
+			return reason, duration, nil
+		}
 	}
 
-	var err error
-	var duration int64 // server chooses default duration
-	banip := tokens[0] == "/ipban"
-
-	if len(tokens) == 4 {
-		duration, err = strconv.ParseInt(strings.TrimSpace(tokens[3]), 10, 64)
-		if err != nil {
-			return err
+	fields := strings.Fields(text)
+	if len(fields) > 1 {
+		last := fields[len(fields)-1]
+		if duration, err := parseDuration(last); err == nil {
+			return strings.TrimSpace(strings.TrimSuffix(text, last)), duration, nil
 		}
 	}
+	return text, 0, nil
+}
+
+// sendBan bans for the duration at the end of the reason, quote the reason
+// if it ends with something that looks like a duration.
+func sendBan(c *chat, tokens []string) error {
+	banip, tokens := takeFlag(tokens, "--ip")
+	if len(tokens) < 3 {
+		return errors.New("usage: /ban [--ip] user reason [duration, e.g. 600, 10m, 2h, 1d]")
+	}
+	banip = banip || tokens[0] == "/ipban"
 
-	return c.Session.SendBan(tokens[1], tokens[2], time.Duration(duration)*time.Second, banip)
+	reason, duration, err := banReason(tokens[2])
+	if err != nil {
+		return err
+	}
+
+	a := modAction{kind: "ban", target: tokens[1], duration: duration, reason: reason, ip: banip}
+	if err := c.Session.SendBan(a.target, a.reason, a.duration, a.ip); err != nil {
+		return err
+	}
+	c.modLog.expect(a)
+	return nil
 }
 
 func sendUnban(c *chat, tokens []string) error {
@@ -270,20 +463,38 @@ func sendUnban(c *chat, tokens []string) error {
 }
 
 func sendPermBan(c *chat, tokens []string) error {
-	if len(tokens) != 3 {
-		return errors.New("usage: /perm[ip] user reason")
+	banip, tokens := takeFlag(tokens, "--ip")
+	if len(tokens) < 3 {
+		return errors.New("usage: /perm [--ip] user reason")
+	}
+	banip = banip || tokens[0] == "/permip"
+
+	reason := tokens[2]
+	if strings.HasPrefix(reason, `"`) || strings.HasPrefix(reason, "'") {
+		// a quoted reason is unquoted like the reason of /ban
+		quoted, err := parseArgs(reason, 0)
+		if err != nil {
+			return err
+		}
+		if len(quoted) == 1 {
+			reason = quoted[0]
+		}
+	}
+
+	a := modAction{kind: "ban", target: tokens[1], reason: reason, perm: true, ip: banip}
+	if err := c.Session.SendPermanentBan(a.target, a.reason, a.ip); err != nil {
+		return err
 	}
-	banip := tokens[0] == "/permip"
-	return c.Session.SendPermanentBan(tokens[1], tokens[2], banip)
+	c.modLog.expect(a)
+	return nil
 }
 
 func sendSubOnly(c *chat, tokens []string) error {
-	so := tokens[1]
-	if len(tokens) != 2 || (so != "on" && so != "off") {
+	if len(tokens) != 2 || (tokens[1] != "on" && tokens[1] != "off") {
 		return errors.New("usage: /subonly {on,off}")
 	}
 
-	subonly := so == "on"
+	subonly := tokens[1] == "on"
 	return c.Session.SendSubOnly(subonly)
 }
 
@@ -312,8 +523,37 @@ func sendWhisper(c *chat, tokens []string) error {
 	nick := tokens[1]
 	message := strings.Join(tokens[2:], " ")
 
+	if err := c.Session.SendPrivateMessage(nick, message); err != nil {
+		return err
+	}
 	c.renderSendPrivateMessage(nick, message)
-	return c.Session.SendPrivateMessage(nick, message)
+	c.logEvent(logEntry{Type: "PRIVMSGSENT", Timestamp: time.Now(), Target: nick, Data: message})
+	return nil
+}
+
+func openQuery(c *chat, tokens []string) error {
+	if len(tokens) != 2 {
+		return errors.New("usage: /query user")
+	}
+
+	c.buffers.showPrivate(tokens[1])
+	return nil
+}
+
+func closeQuery(c *chat, tokens []string) error {
+	if len(tokens) > 2 {
+		return errors.New("usage: /close [user]")
+	}
+
+	if len(tokens) == 2 {
+		return c.buffers.closePrivate(tokens[1])
+	}
+
+	nick, private := c.buffers.privateTarget()
+	if !private {
+		return errors.New("the main buffer cannot be closed")
+	}
+	return c.buffers.closePrivate(nick)
 }
 
 func addIgnore(c *chat, tokens []string) error {
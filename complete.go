@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/awesome-gocui/gocui"
+	runewidth "github.com/mattn/go-runewidth"
+)
+
+// completion is the state of tab completion. Pressing tab again cycles
+// through the candidates, any other key ends the completion.
+type completion struct {
+	start      int // rune offset of the completed word in the input
+	end        int // end of the inserted candidate
+	candidates []string
+	index      int
+	text       string // input after completing, completion ends when it changes
+}
+
+// wordBounds returns the rune offsets of the word around the cursor.
+func (e *inputEditor) wordBounds() (start, end int) {
+	start, end = e.cursor, e.cursor
+	for start > 0 && !isSpace(e.text[start-1]) {
+		start--
+	}
+	for end < len(e.text) && !isSpace(e.text[end]) {
+		end++
+	}
+	return start, end
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\n'
+}
+
+// takesUser is true if the next word of a command line, args are the words
+// before it, is the user of a command like /w or /ban --ip.
+func (c *chat) takesUser(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	command, ok := c.commands[strings.ToLower(args[0])]
+	if !ok || command.arg != argUser {
+		return false
+	}
+	for _, a := range args[1:] {
+		if !strings.HasPrefix(a, "--") {
+			return false
+		}
+	}
+	return true
+}
+
+// completing is true while the input is unchanged since the last completion.
+func (c *chat) completing() bool {
+	cp := c.completion
+	return cp != nil && cp.text == c.input.String() && cp.end == c.input.cursor
+}
+
+// complete completes the word at the cursor, or cycles to the next candidate.
+func (c *chat) complete() {
+	e := c.input
+	if c.completing() {
+		cp := c.completion
+		cp.index = (cp.index + 1) % len(cp.candidates)
+		c.applyCompletion()
+		return
+	}
+
+	start, end := e.wordBounds()
+	prefix := string(e.text[start:e.cursor])
+	args := strings.Fields(string(e.text[e.lineStart():start]))
+
+	candidates := c.candidates(args, prefix)
+	if len(candidates) == 0 {
+		return
+	}
+	c.completion = &completion{start: start, end: end, candidates: candidates}
+	c.applyCompletion()
+}
+
+// applyCompletion replaces the completed word with the current candidate.
+func (c *chat) applyCompletion() {
+	e := c.input
+	cp := c.completion
+
+	e.delete(cp.start, cp.end)
+	e.cursor = cp.start
+	e.insert([]rune(cp.candidates[cp.index])...)
+	if e.cursor == len(e.text) || !isSpace(e.text[e.cursor]) {
+		e.insert(' ')
+	}
+	cp.end = e.cursor
+	cp.text = e.String()
+}
+
+// candidates returns the completions of prefix, args are the words before it.
+// Commands are completed at the start of a line, users after commands taking
+// a user, colors after /tag user, modifiers after "emote:" and users and
+// emotes everywhere else.
+func (c *chat) candidates(args []string, prefix string) []string {
+	switch {
+	case len(args) == 0 && strings.HasPrefix(prefix, "/"):
+		return matching(c.commandNames(), prefix)
+	case c.takesUser(args):
+		return c.rankNicks(matching(c.nicks(), prefix))
+	case len(args) == 2 && strings.EqualFold(args[0], "/tag"):
+		return matching(tagColors, prefix)
+	case prefix == "":
+		return nil
+	case strings.Contains(prefix, ":"):
+		return c.modifierCandidates(prefix)
+	}
+
+	emotes := matching(c.emoteNames(), prefix)
+	return append(c.rankNicks(matching(c.nicks(), prefix)), emotes...)
+}
+
+// modifierCandidates completes the last modifier of an emote, like "PepeLaugh:wi".
+func (c *chat) modifierCandidates(prefix string) []string {
+	i := strings.LastIndex(prefix, ":")
+	if _, _, ok := c.parseEmote(prefix[:i]); !ok {
+		return nil
+	}
+
+	modifiers := matching(c.modifierNames(), prefix[i+1:])
+	for j, m := range modifiers {
+		modifiers[j] = prefix[:i+1] + m
+	}
+	return modifiers
+}
+
+// matching returns the words starting with prefix, ignoring case.
+func matching(words []string, prefix string) []string {
+	prefix = strings.ToLower(prefix)
+	matches := make([]string, 0)
+	for _, w := range words {
+		if strings.HasPrefix(strings.ToLower(w), prefix) {
+			matches = append(matches, w)
+		}
+	}
+	return matches
+}
+
+func (c *chat) commandNames() []string {
+	names := make([]string, 0, len(c.commands))
+	for name, cmd := range c.commands {
+		if c.visible(cmd) {
+			names = append(names, name)
+		}
+	}
+	names = append(names, c.plugins.commandNames()...)
+	names = append(names, c.aliasNames()...)
+	sort.Strings(names)
+	return names
+}
+
+func (c *chat) nicks() []string {
+	users := c.Session.GetUsers()
+	nicks := make([]string, 0, len(users))
+	for _, u := range users {
+		nicks = append(nicks, u.Nick)
+	}
+	return nicks
+}
+
+// rankNicks sorts nicks by when they last spoke in the main buffer, most
+// recent first, and alphabetically after that.
+func (c *chat) rankNicks(nicks []string) []string {
+	rank := make(map[string]int)
+	gw := c.guiwrapper
+	gw.RLock()
+	for i := len(gw.messages) - 1; i >= 0; i-- {
+		nick := strings.ToLower(gw.messages[i].nick)
+		if _, ok := rank[nick]; !ok && nick != "" {
+			rank[nick] = len(rank)
+		}
+	}
+	gw.RUnlock()
+
+	sort.SliceStable(nicks, func(i, j int) bool {
+		ri, iSpoke := rank[strings.ToLower(nicks[i])]
+		rj, jSpoke := rank[strings.ToLower(nicks[j])]
+		if iSpoke != jSpoke {
+			return iSpoke
+		}
+		if iSpoke {
+			return ri < rj
+		}
+		return strings.ToLower(nicks[i]) < strings.ToLower(nicks[j])
+	})
+	return nicks
+}
+
+// renderCompletions shows the candidates above the input view, whose top is at y0, while completing.
+func (c *chat) renderCompletions(g *gocui.Gui, x0, y0, x1 int) error {
+	v, err := g.SetView("completions", x0, y0-3, x1, y0-1, 0)
+	if err != nil {
+		if !gocui.IsUnknownView(err) {
+			return err
+		}
+		v.Frame = true
+		v.Wrap = false
+	}
+
+	v.Visible = c.completing()
+	if !v.Visible {
+		return nil
+	}
+	cp := c.completion
+	if _, err := g.SetViewOnTop("completions"); err != nil {
+		return err
+	}
+
+	width, _ := v.Size()
+	first := 0
+	// scroll right until the selected candidate fits
+	for runewidth.StringWidth(strings.Join(cp.candidates[first:cp.index+1], "  ")) > width && first < cp.index {
+		first++
+	}
+
+	v.Clear()
+	v.Title = fmt.Sprintf(" %d/%d ", cp.index+1, len(cp.candidates))
+	for i, candidate := range cp.candidates[first:] {
+		if i > 0 {
+			fmt.Fprint(v, "  ")
+		}
+		if first+i == cp.index {
+			candidate = fmt.Sprintf("%s%s%s", Reversed, candidate, reset)
+		}
+		fmt.Fprint(v, candidate)
+	}
+	return nil
+}
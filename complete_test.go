@@ -0,0 +1,85 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+func TestCompletionCandidates(t *testing.T) {
+	// we are a moderator, privileged commands are completed
+	s := &fakeSession{users: []dggchat.User{{Nick: "bob"}, {Nick: "Bilbo"}, {Nick: "alice"}, {Nick: "Bea"}, {Nick: "tester", Features: []string{dggchat.FeatureModerator}}}}
+	c := newTestChat(t, testConfig(), s)
+	c.setEmotes([]string{"PepeLaugh", "BibleThump"}, []string{"wide", "mirror"})
+	c.renderMessage(dggchat.Message{Sender: dggchat.User{Nick: "bob"}, Timestamp: time.Now(), Message: "hi"}, true)
+	c.renderMessage(dggchat.Message{Sender: dggchat.User{Nick: "Bea"}, Timestamp: time.Now(), Message: "hi"}, true)
+
+	tests := []struct {
+		args   []string
+		prefix string
+		want   []string
+	}{
+		{nil, "/unb", []string{"/unban"}},
+		{[]string{"/w"}, "", []string{"Bea", "bob", "alice", "Bilbo", "tester"}},
+		{[]string{"/mute"}, "b", []string{"Bea", "bob", "Bilbo"}},
+		{[]string{"/ban"}, "b", []string{"Bea", "bob", "Bilbo"}},
+		{[]string{"/ban", "--ip"}, "a", []string{"alice"}},
+		{[]string{"/perm"}, "al", []string{"alice"}},
+		{[]string{"/ban", "bob"}, "al", []string{"alice"}},
+		{[]string{"/tag", "bob"}, "b", []string{"black", "blue"}},
+		{[]string{"hello"}, "b", []string{"Bea", "bob", "Bilbo", "BibleThump"}},
+		{[]string{"/me"}, "pe", []string{"PepeLaugh"}},
+		{nil, "PepeLaugh:w", []string{"PepeLaugh:wide"}},
+		{nil, "PepeLaugh:wide:", []string{"PepeLaugh:wide:mirror", "PepeLaugh:wide:wide"}},
+		{nil, "", nil},
+	}
+
+	for _, tt := range tests {
+		if got := c.candidates(tt.args, tt.prefix); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("candidates(%q, %q) = %q, want %q", tt.args, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestCompleteMidSentence(t *testing.T) {
+	s := &fakeSession{users: []dggchat.User{{Nick: "Zoë"}, {Nick: "zed"}}}
+	c := newTestChat(t, testConfig(), s)
+
+	c.input.set("ünïcode zo and more")
+	c.input.cursor = len([]rune("ünïcode zo"))
+
+	c.complete()
+	if got, want := c.input.String(), "ünïcode Zoë and more"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if want := len([]rune("ünïcode Zoë")); c.input.cursor != want {
+		t.Errorf("cursor at %d, want %d", c.input.cursor, want)
+	}
+
+	// only one candidate, tab again keeps it
+	c.complete()
+	if got, want := c.input.String(), "ünïcode Zoë and more"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCompleteCycles(t *testing.T) {
+	s := &fakeSession{users: []dggchat.User{{Nick: "bob"}, {Nick: "bilbo"}}}
+	c := newTestChat(t, testConfig(), s)
+
+	typeKeys(c, "/w b")
+	c.complete()
+	c.complete()
+	if got, want := c.input.String(), "/w bob "; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// typing ends the completion, the next tab completes the new word
+	typeKeys(c, "hi")
+	c.complete()
+	if c.input.String() != "/w bob hi" || c.completing() {
+		t.Errorf("completed %q without candidates", c.input.String())
+	}
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/awesome-gocui/gocui"
+	runewidth "github.com/mattn/go-runewidth"
+)
+
+const (
+	// longest message the chat server accepts
+	maxMessageLength = 512
+	// the input view grows up to this many lines
+	maxInputLines = 5
+	// gocui reports Alt+key as Esc followed by key
+	escTimeout = 50 * time.Millisecond
+	// without bracketed paste, keys arriving faster than this are pasted
+	defaultPasteThreshold = 15 * time.Millisecond
+)
+
+// inputEditor holds the text of the input view. It is the source of truth,
+// the view is redrawn from it after every change.
+type inputEditor struct {
+	text   []rune
+	cursor int
+
+	lastKey time.Time
+	escAt   time.Time // last Esc, starts Alt+key combos and escape sequences
+	seq     []rune    // escape sequence being read, nil if none
+
+	pasting   bool // between bracketed paste markers
+	bracketed bool // the terminal sends paste markers, no need to guess from timing
+	pasted    bool // the text contains pasted newlines
+	confirm   bool // waiting for confirmation to send a multi-line paste
+
+	pasteThreshold time.Duration
+	onFocusLost    func()
+}
+
+// enableTerminalModes turns on bracketed paste and focus events.
+func enableTerminalModes() {
+	os.Stdout.WriteString("\u001b[?2004h\u001b[?1004h")
+}
+
+func disableTerminalModes() {
+	os.Stdout.WriteString("\u001b[?2004l\u001b[?1004l")
+}
+
+func (e *inputEditor) String() string {
+	return string(e.text)
+}
+
+func (e *inputEditor) set(s string) {
+	e.text = []rune(s)
+	e.cursor = len(e.text)
+	e.pasted = false
+	e.confirm = false
+}
+
+func (e *inputEditor) clear() {
+	e.set("")
+}
+
+func (e *inputEditor) insert(r ...rune) {
+	text := make([]rune, 0, len(e.text)+len(r))
+	text = append(text, e.text[:e.cursor]...)
+	text = append(text, r...)
+	e.text = append(text, e.text[e.cursor:]...)
+	e.cursor += len(r)
+	e.confirm = false
+}
+
+// delete removes the text between from and to and moves the cursor to from.
+func (e *inputEditor) delete(from, to int) {
+	if from < 0 {
+		from = 0
+	}
+	if to > len(e.text) {
+		to = len(e.text)
+	}
+	if from >= to {
+		return
+	}
+	e.text = append(e.text[:from], e.text[to:]...)
+	e.cursor = from
+	e.confirm = false
+}
+
+func (e *inputEditor) lineStart() int {
+	i := e.cursor
+	for i > 0 && e.text[i-1] != '\n' {
+		i--
+	}
+	return i
+}
+
+func (e *inputEditor) lineEnd() int {
+	i := e.cursor
+	for i < len(e.text) && e.text[i] != '\n' {
+		i++
+	}
+	return i
+}
+
+// wordLeft returns the start of the word before the cursor, like readline.
+func (e *inputEditor) wordLeft() int {
+	i := e.cursor
+	for i > 0 && !isWordRune(e.text[i-1]) {
+		i--
+	}
+	for i > 0 && isWordRune(e.text[i-1]) {
+		i--
+	}
+	return i
+}
+
+func (e *inputEditor) wordRight() int {
+	i := e.cursor
+	for i < len(e.text) && !isWordRune(e.text[i]) {
+		i++
+	}
+	for i < len(e.text) && isWordRune(e.text[i]) {
+		i++
+	}
+	return i
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// position returns the line and the display column of the cursor.
+func (e *inputEditor) position() (row, col int) {
+	start := 0
+	for i, r := range e.text[:e.cursor] {
+		if r == '\n' {
+			row++
+			start = i + 1
+		}
+	}
+	return row, runewidth.StringWidth(string(e.text[start:e.cursor]))
+}
+
+func (e *inputEditor) lineCount() int {
+	return strings.Count(string(e.text), "\n") + 1
+}
+
+// moveLine moves the cursor up or down a line, returns false if there is no such line.
+func (e *inputEditor) moveLine(dy int) bool {
+	row, col := e.position()
+	lines := strings.Split(string(e.text), "\n")
+	target := row + dy
+	if target < 0 || target >= len(lines) {
+		return false
+	}
+
+	cursor := 0
+	for _, l := range lines[:target] {
+		cursor += len([]rune(l)) + 1
+	}
+	width := 0
+	for _, r := range lines[target] {
+		if width+runewidth.RuneWidth(r) > col {
+			break
+		}
+		width += runewidth.RuneWidth(r)
+		cursor++
+	}
+	e.cursor = cursor
+	return true
+}
+
+// messages returns the non-empty lines of the input, each is sent as a message.
+func (e *inputEditor) messages() []string {
+	var messages []string
+	for _, l := range strings.Split(string(e.text), "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			messages = append(messages, l)
+		}
+	}
+	return messages
+}
+
+// altPending is true right after Esc, gocui splits Alt+key into Esc and key.
+func (e *inputEditor) altPending(now time.Time) bool {
+	return !e.escAt.IsZero() && now.Sub(e.escAt) < escTimeout
+}
+
+// readSequence reads bracketed paste markers (Esc [200~ and Esc [201~) and
+// focus events (Esc [I and Esc [O), returns false if the key is not part of
+// an escape sequence. Focus events only arrive while the input view is focused,
+// other views don't read escape sequences.
+func (e *inputEditor) readSequence(ch rune) bool {
+	if len(e.seq) == 0 && (ch == 'I' || ch == 'O') {
+		e.seq = nil
+		if ch == 'O' && e.onFocusLost != nil {
+			e.onFocusLost()
+		}
+		return true
+	}
+	if ch >= '0' && ch <= '9' {
+		e.seq = append(e.seq, ch)
+		return true
+	}
+
+	seq := string(e.seq)
+	e.seq = nil
+	if ch != '~' {
+		e.insert([]rune("[" + seq)...)
+		return false
+	}
+
+	switch seq {
+	case "200":
+		e.pasting = true
+		e.bracketed = true
+	case "201":
+		e.pasting = false
+	default:
+		e.insert([]rune("[" + seq + "~")...)
+	}
+	return true
+}
+
+// isPaste is true for keys that are part of a paste. Terminals without
+// bracketed paste fall back to the time since the last key.
+func (e *inputEditor) isPaste(now time.Time) bool {
+	if e.pasting || e.bracketed {
+		return e.pasting
+	}
+	threshold := e.pasteThreshold
+	if threshold <= 0 {
+		threshold = defaultPasteThreshold
+	}
+	return now.Sub(e.lastKey) < threshold
+}
+
+// edit implements gocui.Editor for the input view, layout redraws the view.
+func (c *chat) edit(v *gocui.View, key gocui.Key, ch rune, mod gocui.Modifier) {
+	e := c.input
+	now := time.Now()
+	defer func() { e.lastKey = now }()
+
+	if c.historySearch != nil && c.editHistorySearch(key, ch) {
+		return
+	}
+	if e.seq != nil && e.readSequence(ch) {
+		return
+	}
+
+	alt := mod == gocui.ModAlt || e.altPending(now)
+	e.escAt = time.Time{}
+
+	switch {
+	case key == gocui.KeyEsc:
+		e.escAt = now
+		e.confirm = false
+	case alt && ch == '[':
+		e.seq = []rune{}
+	case alt && ch == 'b':
+		e.cursor = e.wordLeft()
+	case alt && ch == 'f':
+		e.cursor = e.wordRight()
+	case alt && ch == 'd':
+		e.delete(e.cursor, e.wordRight())
+	case alt && (key == gocui.KeyBackspace || key == gocui.KeyBackspace2):
+		e.delete(e.wordLeft(), e.cursor)
+	case ch != 0:
+		e.insert(ch)
+	case key == gocui.KeySpace:
+		e.insert(' ')
+	case key == gocui.KeyBackspace || key == gocui.KeyBackspace2:
+		e.delete(e.cursor-1, e.cursor)
+	case key == gocui.KeyDelete || key == gocui.KeyCtrlD:
+		e.delete(e.cursor, e.cursor+1)
+	case key == gocui.KeyArrowLeft || key == gocui.KeyCtrlB:
+		if e.cursor > 0 {
+			e.cursor--
+		}
+	case key == gocui.KeyArrowRight:
+		if e.cursor < len(e.text) {
+			e.cursor++
+		}
+	case key == gocui.KeyHome || key == gocui.KeyCtrlA:
+		e.cursor = e.lineStart()
+	case key == gocui.KeyEnd || key == gocui.KeyCtrlE:
+		e.cursor = e.lineEnd()
+	case key == gocui.KeyCtrlW:
+		e.delete(e.wordLeft(), e.cursor)
+	case key == gocui.KeyCtrlU:
+		e.delete(e.lineStart(), e.cursor)
+	case key == gocui.KeyCtrlK:
+		e.delete(e.cursor, e.lineEnd())
+	}
+}
+
+// renderInput redraws the input view from c.input, keeping the cursor visible.
+func (c *chat) renderInput(v *gocui.View) {
+	e := c.input
+	v.Clear()
+	fmt.Fprint(v, e.String())
+
+	row, col := e.position()
+	width, height := v.Size()
+	ox, oy := 0, 0
+	if col >= width {
+		ox = col - width + 1
+	}
+	if row >= height {
+		oy = row - height + 1
+	}
+	v.SetOrigin(ox, oy)
+	v.SetCursor(col-ox, row-oy)
+
+	v.Title = c.inputTitle()
+}
+
+// inputTitle shows the length of the current line against the message limit.
+func (c *chat) inputTitle() string {
+	e := c.input
+	if c.historySearch != nil {
+		return c.historySearchTitle()
+	}
+	if e.confirm {
+		return fmt.Sprintf(" send %d lines? Enter to confirm, Esc to edit: ", len(e.messages()))
+	}
+
+	line := e.text[e.lineStart():e.lineEnd()]
+	length := len([]rune(strings.TrimSpace(string(line))))
+	if length > maxMessageLength {
+		return fmt.Sprintf(" send: %d/%d too long! ", length, maxMessageLength)
+	}
+	return fmt.Sprintf(" send: %d/%d ", length, maxMessageLength)
+}
+
+func (c *chat) sendInput(g *gocui.Gui, v *gocui.View) error {
+	e := c.input
+	now := time.Now()
+
+	if c.historySearch != nil {
+		c.acceptHistorySearch()
+		return nil
+	}
+
+	// Alt+Enter, or Enter within a paste, starts a new line
+	if e.altPending(now) || e.isPaste(now) {
+		if !e.altPending(now) {
+			e.pasted = true
+		}
+		e.escAt = time.Time{}
+		e.lastKey = now
+		e.insert('\n')
+		return nil
+	}
+
+	messages := e.messages()
+	if len(messages) == 0 {
+		e.clear()
+		return nil
+	}
+
+	for _, m := range messages {
+		if n := len([]rune(m)); n > maxMessageLength {
+			c.renderError(fmt.Sprintf("message is %d characters long, the limit is %d", n, maxMessageLength))
+			return nil
+		}
+	}
+
+	if e.pasted && len(messages) > 1 && !e.confirm {
+		e.confirm = true
+		return nil
+	}
+
+	e.clear()
+	for _, m := range messages {
+		c.handleInput(m)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+func typeKeys(c *chat, s string) {
+	for _, r := range s {
+		c.edit(nil, 0, r, gocui.ModNone)
+	}
+}
+
+func TestEditorKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		key  gocui.Key
+		mod  gocui.Modifier
+		want string
+	}{
+		{"ctrl+w", gocui.KeyCtrlW, gocui.ModNone, "hello big "},
+		{"ctrl+u", gocui.KeyCtrlU, gocui.ModNone, ""},
+		{"alt+backspace", gocui.KeyBackspace2, gocui.ModAlt, "hello big "},
+		{"backspace", gocui.KeyBackspace2, gocui.ModNone, "hello big worl"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestChat(t, testConfig(), &fakeSession{})
+			typeKeys(c, "hello big world")
+			c.edit(nil, tt.key, 0, tt.mod)
+			if got := c.input.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditorWordMovement(t *testing.T) {
+	c := newTestChat(t, testConfig(), &fakeSession{})
+	typeKeys(c, "one two three")
+
+	c.edit(nil, gocui.KeyEsc, 0, gocui.ModNone)
+	c.edit(nil, 0, 'b', gocui.ModNone)
+	c.edit(nil, 0, 'b', gocui.ModAlt)
+	typeKeys(c, "x")
+	c.edit(nil, gocui.KeyCtrlE, 0, gocui.ModNone)
+	typeKeys(c, "!")
+
+	if got, want := c.input.String(), "one xtwo three!"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestEditorMultiline(t *testing.T) {
+	c := newTestChat(t, testConfig(), &fakeSession{})
+	c.input.set("first\nsecond line\nthird")
+
+	if !c.input.moveLine(-1) || !c.input.moveLine(-1) || c.input.moveLine(-1) {
+		t.Fatal("expected to move up two lines")
+	}
+	if row, col := c.input.position(); row != 0 || col != 5 {
+		t.Errorf("cursor at %d:%d, want 0:5", row, col)
+	}
+	if want := []string{"first", "second line", "third"}; !reflect.DeepEqual(c.input.messages(), want) {
+		t.Errorf("got %q, want %q", c.input.messages(), want)
+	}
+}
+
+func TestBracketedPaste(t *testing.T) {
+	s := &fakeSession{}
+	c := newTestChat(t, testConfig(), s)
+
+	c.edit(nil, gocui.KeyEsc, 0, gocui.ModNone)
+	typeKeys(c, "[200~one")
+	c.sendInput(nil, nil)
+	typeKeys(c, "two")
+	c.edit(nil, gocui.KeyEsc, 0, gocui.ModNone)
+	typeKeys(c, "[201~")
+
+	if got, want := c.input.String(), "one\ntwo"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// pasted lines are only sent after confirming
+	c.input.lastKey = time.Time{}
+	c.sendInput(nil, nil)
+	if len(s.messages()) != 0 || !c.input.confirm {
+		t.Fatalf("multi-line paste sent without confirmation")
+	}
+	c.sendInput(nil, nil)
+	if want := []string{"MSG one", "MSG two"}; !reflect.DeepEqual(s.messages(), want) {
+		t.Errorf("sent %q, want %q", s.messages(), want)
+	}
+	if c.input.String() != "" {
+		t.Errorf("input not cleared")
+	}
+}
+
+func TestPasteTiming(t *testing.T) {
+	cfg := testConfig()
+	cfg.PasteThreshold = 30
+	c := newTestChat(t, cfg, &fakeSession{})
+	e := c.input
+
+	now := time.Now()
+	e.lastKey = now.Add(-20 * time.Millisecond)
+	if !e.isPaste(now) {
+		t.Errorf("key 20ms after the last one is not pasted with a 30ms threshold")
+	}
+
+	// once the terminal sent paste markers, timing is not used anymore
+	c.edit(nil, gocui.KeyEsc, 0, gocui.ModNone)
+	typeKeys(c, "[200~x")
+	c.edit(nil, gocui.KeyEsc, 0, gocui.ModNone)
+	typeKeys(c, "[201~")
+	e.lastKey = now.Add(-time.Millisecond)
+	if e.isPaste(now) {
+		t.Errorf("fast key is pasted although the terminal supports bracketed paste")
+	}
+}
+
+func TestMessageLength(t *testing.T) {
+	s := &fakeSession{}
+	c := newTestChat(t, testConfig(), s)
+	c.input.set(strings.Repeat("a", maxMessageLength+1))
+
+	c.sendInput(nil, nil)
+	if len(s.messages()) != 0 {
+		t.Errorf("sent a message longer than the limit")
+	}
+	if countLines(c.guiwrapper, "the limit is 512") != 1 {
+		t.Errorf("missing error, rendered %q", lines(c.guiwrapper))
+	}
+}
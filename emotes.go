@@ -2,36 +2,198 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"sort"
+	"strings"
+	"time"
 )
 
 const emoteEndpoint = "https://raw.githubusercontent.com/MemeLabs/chat-gui/master/assets/emotes.json"
 
+// modifiers of chat-gui, used unless the endpoint lists its own
+var defaultEmoteModifiers = []string{
+	"banned", "dank", "flip", "hyper", "lag", "love", "mirror", "pause",
+	"rain", "rustle", "slide", "snow", "spin", "virus", "wide", "worth",
+}
+
 type emoteEndpointResponse struct {
-	Default []string `json:"default"`
+	Default   []string `json:"default"`
+	Modifiers []string `json:"modifiers,omitempty"`
+}
+
+type emoteConfig struct {
+	URL         string            `toml:"url"`
+	Cache       string            `toml:"cache"`
+	Substitutes map[string]string `toml:"substitutes"` // text shown instead of an emote
 }
 
-func getEmotes() ([]string, error) {
-	emotes := make([]string, 0)
+var emoteClient = &http.Client{Timeout: 10 * time.Second}
 
-	resp, err := http.Get(emoteEndpoint)
+// getEmotes fetches the emote list, body is kept for the cache.
+func getEmotes(url string) (er emoteEndpointResponse, body []byte, err error) {
+	resp, err := emoteClient.Get(url)
 	if err != nil {
-		return emotes, err
+		return er, nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return emotes, fmt.Errorf("emote endpoint status code %d", resp.StatusCode)
+		return er, nil, fmt.Errorf("emote endpoint status code %d", resp.StatusCode)
 	}
 
-	var er emoteEndpointResponse
+	body, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return er, nil, err
+	}
+	err = json.Unmarshal(body, &er)
+	return er, body, err
+}
 
-	err = json.NewDecoder(resp.Body).Decode(&er)
+func readEmoteCache(file string) (er emoteEndpointResponse, err error) {
+	if file == "" {
+		return er, errors.New("emote cache disabled")
+	}
+	body, err := ioutil.ReadFile(file)
 	if err != nil {
-		return emotes, err
+		return er, err
+	}
+	err = json.Unmarshal(body, &er)
+	return er, err
+}
+
+// loadEmotes fetches the emote list and updates the cache, the cached list is
+// used while the endpoint can't be reached.
+func (c *chat) loadEmotes() {
+	cfg := c.config.Emotes
+	er, body, err := getEmotes(cfg.URL)
+	switch {
+	case err == nil && cfg.Cache != "":
+		if err := ioutil.WriteFile(cfg.Cache, body, 0600); err != nil {
+			c.renderDebug(fmt.Sprintf("caching emotes: %v", err))
+		}
+	case err != nil:
+		c.renderDebug(fmt.Sprintf("fetching emotes: %v, using cache", err))
+		er, err = readEmoteCache(cfg.Cache)
+		if err != nil {
+			c.renderError(fmt.Sprintf("loading emotes: %v", err))
+			return
+		}
+	}
+
+	modifiers := er.Modifiers
+	if len(modifiers) == 0 {
+		modifiers = defaultEmoteModifiers
+	}
+	c.setEmotes(er.Default, modifiers)
+}
+
+func (c *chat) setEmotes(emotes []string, modifiers []string) {
+	c.emoteMu.Lock()
+	defer c.emoteMu.Unlock()
+
+	c.emotes = append([]string{}, emotes...)
+	sort.Strings(c.emotes)
+	c.emoteSet = make(map[string]bool, len(emotes))
+	for _, e := range emotes {
+		c.emoteSet[e] = true
+	}
+	c.emoteModifiers = make(map[string]bool, len(modifiers))
+	for _, m := range modifiers {
+		c.emoteModifiers[m] = true
+	}
+}
+
+func (c *chat) emoteNames() []string {
+	c.emoteMu.RLock()
+	defer c.emoteMu.RUnlock()
+	return append([]string{}, c.emotes...)
+}
+
+func (c *chat) modifierNames() []string {
+	c.emoteMu.RLock()
+	defer c.emoteMu.RUnlock()
+	names := make([]string, 0, len(c.emoteModifiers))
+	for m := range c.emoteModifiers {
+		names = append(names, m)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseEmote splits words like "PepeLaugh:wide:mirror" into the emote and its
+// modifiers, ok is false unless the emote and all modifiers are known.
+func (c *chat) parseEmote(word string) (emote string, modifiers []string, ok bool) {
+	c.emoteMu.RLock()
+	defer c.emoteMu.RUnlock()
+
+	parts := strings.Split(word, ":")
+	if !c.emoteSet[parts[0]] {
+		return "", nil, false
+	}
+	for _, m := range parts[1:] {
+		if !c.emoteModifiers[m] {
+			return "", nil, false
+		}
+	}
+	return parts[0], parts[1:], true
+}
+
+// formatEmotes styles the emotes in a message, after is the style the
+// message continues with after an emote.
+func (c *chat) formatEmotes(message string, after color) string {
+	words := strings.Split(message, " ")
+	for i, word := range words {
+		emote, modifiers, ok := c.parseEmote(word)
+		if !ok {
+			continue
+		}
+
+		c.config.RLock()
+		if sub, ok := c.config.Emotes.Substitutes[emote]; ok {
+			emote = sub
+		}
+		c.config.RUnlock()
+
+		if len(modifiers) > 0 {
+			emote += ":" + strings.Join(modifiers, ":")
+		}
+		words[i] = fmt.Sprintf("%s%s%s%s", c.theme.get("emote"), emote, reset, after)
+	}
+	return strings.Join(words, " ")
+}
+
+func listEmotes(c *chat, tokens []string) error {
+	emotes := c.emoteNames()
+	if len(emotes) == 0 {
+		return errors.New("no emotes loaded")
+	}
+
+	filter := ""
+	if len(tokens) > 1 {
+		filter = strings.ToLower(tokens[1])
+	}
+
+	c.config.RLock()
+	var names []string
+	for _, e := range emotes {
+		if !strings.Contains(strings.ToLower(e), filter) {
+			continue
+		}
+		if sub, ok := c.config.Emotes.Substitutes[e]; ok {
+			e = fmt.Sprintf("%s (%s)", e, sub)
+		}
+		names = append(names, e)
+	}
+	c.config.RUnlock()
+
+	if len(names) == 0 {
+		return fmt.Errorf("no emotes matching %s", tokens[1])
 	}
 
-	emotes = append(emotes, er.Default...)
-	return emotes, nil
+	c.renderCommand(fmt.Sprintf("%d emotes: %s", len(names), strings.Join(names, ", ")))
+	c.renderCommand(fmt.Sprintf("modifiers (emote:modifier): %s", strings.Join(c.modifierNames(), ", ")))
+	return nil
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFormatEmotes(t *testing.T) {
+	cfg := testConfig()
+	cfg.Emotes.Substitutes = map[string]string{"OMEGALUL": "😂"}
+	c := newTestChat(t, cfg, &fakeSession{})
+	c.setEmotes([]string{"PepeLaugh", "OMEGALUL"}, []string{"wide"})
+	emote := string(c.theme.get("emote"))
+
+	tests := []struct {
+		message string
+		want    string
+	}{
+		{"hi PepeLaugh", "hi " + emote + "PepeLaugh" + string(reset)},
+		{"PepeLaugh:wide", emote + "PepeLaugh:wide" + string(reset)},
+		{"PepeLaugh:nope pepelaugh", "PepeLaugh:nope pepelaugh"},
+		{"OMEGALUL", emote + "😂" + string(reset)},
+	}
+
+	for _, tt := range tests {
+		if got := c.formatEmotes(tt.message, none); got != tt.want {
+			t.Errorf("formatEmotes(%q) = %q, want %q", tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestLoadEmotesCache(t *testing.T) {
+	online := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !online {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"default":["PepeLaugh","Kappa"]}`))
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.Emotes = emoteConfig{URL: srv.URL, Cache: filepath.Join(t.TempDir(), "emotes.json")}
+
+	c := newTestChat(t, cfg, &fakeSession{})
+	c.loadEmotes()
+	if want := []string{"Kappa", "PepeLaugh"}; !reflect.DeepEqual(c.emoteNames(), want) {
+		t.Fatalf("loaded %q, want %q", c.emoteNames(), want)
+	}
+
+	online = false
+	c = newTestChat(t, cfg, &fakeSession{})
+	c.loadEmotes()
+	if want := []string{"Kappa", "PepeLaugh"}; !reflect.DeepEqual(c.emoteNames(), want) {
+		t.Errorf("loaded %q from cache, want %q", c.emoteNames(), want)
+	}
+	if !reflect.DeepEqual(c.modifierNames(), defaultEmoteModifiers) {
+		t.Errorf("default modifiers not used, got %q", c.modifierNames())
+	}
+}
+
+func TestEmotesCommand(t *testing.T) {
+	c := newTestChat(t, testConfig(), &fakeSession{})
+	c.setEmotes([]string{"PepeLaugh", "Kappa", "PepoG"}, defaultEmoteModifiers)
+
+	c.handleInput("/emotes pep")
+	if countLines(c.guiwrapper, "2 emotes: PepeLaugh, PepoG") != 1 {
+		t.Errorf("emotes not listed, rendered %q", lines(c.guiwrapper))
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+	"github.com/gorilla/websocket"
+)
+
+// fakeSession records everything sent through it as a readable line like
+// "MSG hello" or "MUTE bob 10m0s" and lets tests emit events to the
+// registered handlers.
+type fakeSession struct {
+	users []dggchat.User
+	sent  []string
+	err   error // returned by all Send* methods if set
+
+	onMessage     func(dggchat.Message, *dggchat.Session)
+	onNames       func(dggchat.Names, *dggchat.Session)
+	onMute        func(dggchat.Mute, *dggchat.Session)
+	onUnmute      func(dggchat.Mute, *dggchat.Session)
+	onBan         func(dggchat.Ban, *dggchat.Session)
+	onUnban       func(dggchat.Ban, *dggchat.Session)
+	onError       func(string, *dggchat.Session)
+	onJoin        func(dggchat.RoomAction, *dggchat.Session)
+	onQuit        func(dggchat.RoomAction, *dggchat.Session)
+	onPM          func(dggchat.PrivateMessage, *dggchat.Session)
+	onBroadcast   func(dggchat.Broadcast, *dggchat.Session)
+	onPing        func(dggchat.Ping, *dggchat.Session)
+	onSubOnly     func(dggchat.SubOnly, *dggchat.Session)
+	onSocketError func(error, *dggchat.Session)
+
+	sync.Mutex
+}
+
+func (f *fakeSession) send(format string, a ...interface{}) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.sent = append(f.sent, fmt.Sprintf(format, a...))
+	return nil
+}
+
+// messages returns everything sent so far.
+func (f *fakeSession) messages() []string {
+	f.Lock()
+	defer f.Unlock()
+	return append([]string{}, f.sent...)
+}
+
+func (f *fakeSession) Open() error                  { return nil }
+func (f *fakeSession) Close() error                 { return nil }
+func (f *fakeSession) SetDialer(d websocket.Dialer) {}
+
+func (f *fakeSession) GetUsers() []dggchat.User {
+	f.Lock()
+	defer f.Unlock()
+	return append([]dggchat.User{}, f.users...)
+}
+
+func (f *fakeSession) SendMessage(message string) error {
+	return f.send("MSG %s", message)
+}
+
+func (f *fakeSession) SendAction(message string) error {
+	return f.SendMessage("/me " + message)
+}
+
+func (f *fakeSession) SendPrivateMessage(nick string, message string) error {
+	return f.send("PRIVMSG %s %s", nick, message)
+}
+
+func (f *fakeSession) SendMute(nick string, duration time.Duration) error {
+	return f.send("MUTE %s %s", nick, duration)
+}
+
+func (f *fakeSession) SendUnmute(nick string) error {
+	return f.send("UNMUTE %s", nick)
+}
+
+func (f *fakeSession) SendBan(nick string, reason string, duration time.Duration, banip bool) error {
+	return f.send("BAN %s %q %s ip=%t", nick, reason, duration, banip)
+}
+
+func (f *fakeSession) SendPermanentBan(nick string, reason string, banip bool) error {
+	return f.send("BAN %s %q permanent ip=%t", nick, reason, banip)
+}
+
+func (f *fakeSession) SendUnban(nick string) error {
+	return f.send("UNBAN %s", nick)
+}
+
+func (f *fakeSession) SendSubOnly(subonly bool) error {
+	return f.send("SUBONLY %t", subonly)
+}
+
+func (f *fakeSession) SendBroadcast(message string) error {
+	return f.send("BROADCAST %s", message)
+}
+
+func (f *fakeSession) SendPing() error {
+	return f.send("PING")
+}
+
+func (f *fakeSession) AddMessageHandler(fn func(dggchat.Message, *dggchat.Session)) {
+	f.onMessage = fn
+}
+
+func (f *fakeSession) AddNamesHandler(fn func(dggchat.Names, *dggchat.Session)) {
+	f.onNames = fn
+}
+
+func (f *fakeSession) AddMuteHandler(fn func(dggchat.Mute, *dggchat.Session)) {
+	f.onMute = fn
+}
+
+func (f *fakeSession) AddUnmuteHandler(fn func(dggchat.Mute, *dggchat.Session)) {
+	f.onUnmute = fn
+}
+
+func (f *fakeSession) AddBanHandler(fn func(dggchat.Ban, *dggchat.Session)) {
+	f.onBan = fn
+}
+
+func (f *fakeSession) AddUnbanHandler(fn func(dggchat.Ban, *dggchat.Session)) {
+	f.onUnban = fn
+}
+
+func (f *fakeSession) AddErrorHandler(fn func(string, *dggchat.Session)) {
+	f.onError = fn
+}
+
+func (f *fakeSession) AddJoinHandler(fn func(dggchat.RoomAction, *dggchat.Session)) {
+	f.onJoin = fn
+}
+
+func (f *fakeSession) AddQuitHandler(fn func(dggchat.RoomAction, *dggchat.Session)) {
+	f.onQuit = fn
+}
+
+func (f *fakeSession) AddPMHandler(fn func(dggchat.PrivateMessage, *dggchat.Session)) {
+	f.onPM = fn
+}
+
+func (f *fakeSession) AddBroadcastHandler(fn func(dggchat.Broadcast, *dggchat.Session)) {
+	f.onBroadcast = fn
+}
+
+func (f *fakeSession) AddPingHandler(fn func(dggchat.Ping, *dggchat.Session)) {
+	f.onPing = fn
+}
+
+func (f *fakeSession) AddSubOnlyHandler(fn func(dggchat.SubOnly, *dggchat.Session)) {
+	f.onSubOnly = fn
+}
+
+func (f *fakeSession) AddSocketErrorHandler(fn func(error, *dggchat.Session)) {
+	f.onSocketError = fn
+}
@@ -6,4 +6,6 @@ require (
 	github.com/BurntSushi/toml v0.3.1
 	github.com/MemeLabs/dggchat v0.0.0-20201117114323-43344edb4906
 	github.com/awesome-gocui/gocui v0.6.0
+	github.com/gorilla/websocket v1.4.2
+	github.com/mattn/go-runewidth v0.0.4
 )
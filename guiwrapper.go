@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"strings"
 	"sync"
 	"time"
@@ -9,11 +10,52 @@ import (
 	"github.com/awesome-gocui/gocui"
 )
 
+// updater queues changes to the gui, implemented by *gocui.Gui.
+type updater interface {
+	Update(f func(*gocui.Gui) error)
+}
+
+// noGui drops all gui updates, it is used when running headless.
+type noGui struct{}
+
+func (noGui) Update(f func(*gocui.Gui) error) {}
+
+// terminalWriter writes escape sequences like OSC 52 to the terminal. The
+// writes are queued as gui updates, so they happen on the main loop between
+// two flushes instead of interleaving with the output of termbox.
+type terminalWriter struct {
+	gui updater
+	out io.Writer
+}
+
+func (t *terminalWriter) write(seq string) {
+	t.gui.Update(func(*gocui.Gui) error {
+		// returning the error would end the main loop, there is nowhere
+		// else to show it than the terminal that failed
+		io.WriteString(t.out, seq)
+		return nil
+	})
+}
+
 type guiwrapper struct {
-	gui        *gocui.Gui
+	gui        updater
+	theme      *theme
+	name       string // shown in the tab bar, whisper partner for PM buffers
+	private    bool
 	messages   []*guimessage
 	maxlines   int
 	timeformat string
+	// only the active buffer is drawn into the "messages" view, the others
+	// count unread lines until the user switches to them.
+	active   bool
+	unread   int
+	onUnread func()
+	// while the user is scrolled up new messages are counted, the first
+	// of them gets the unread marker.
+	scrolledUp  bool
+	newMessages int
+	markPending bool
+	marker      *guimessage
 	sync.RWMutex
 }
 
@@ -23,11 +65,14 @@ type guimessage struct {
 	msg string
 	// TODO right now only set this when we want to modify tag/highlight/ignore/... later on... not on "system" messages; even though they technically have a sender too...
 	nick string
+	text string // as sent, without formatting, empty for events
+	// style renders tag and msg again with the current theme, see styled
+	style func() (tag string, msg string)
 }
 
 func (gw *guiwrapper) formatMessage(gm *guimessage) string {
 	formattedDate := gm.ts.Format(gw.timeformat)
-	return fmt.Sprintf("[%s]%s%s", formattedDate, gm.tag, gm.msg)
+	return fmt.Sprintf("%s[%s]%s%s%s", gw.theme.get("timestamp"), formattedDate, reset, gm.tag, gm.msg)
 }
 
 func (gw *guiwrapper) redraw() {
@@ -52,18 +97,106 @@ func (gw *guiwrapper) redraw() {
 		gw.Lock()
 		defer gw.Unlock()
 
-		// redraw everything
-		newbuf := ""
-		for _, msg := range gw.messages {
-			newbuf += gw.formatMessage(msg) + "\n"
+		if !gw.active {
+			return nil
 		}
 
+		// redraw everything
+		width, _ := messageView.Size()
+		newbuf, _, _ := gw.content(width, nil)
 		messageView.Clear()
 		fmt.Fprint(messageView, newbuf)
 		return nil
 	})
 }
 
+// content formats all messages with the unread marker in front of the first
+// unread one, markerLine is the line of the marker or -1. If decorate is set,
+// it can restyle a message, it gets the line the message starts on.
+// gw must be locked.
+func (gw *guiwrapper) content(width int, decorate func(msg *guimessage, text string, line int) string) (content string, markerLine int, lines int) {
+	var buf strings.Builder
+	line := 0
+	markerLine = -1
+	for _, msg := range gw.messages {
+		if msg == gw.marker {
+			markerLine = line
+			buf.WriteString(gw.markerLine(width) + "\n")
+			line++
+		}
+		text := gw.formatMessage(msg)
+		if decorate != nil {
+			text = decorate(msg, text, line)
+		}
+		line += wrappedLines(stripANSI(text), width)
+		buf.WriteString(text + "\n")
+	}
+	return buf.String(), markerLine, line
+}
+
+// messageAt returns the message drawn on a line of the "messages" view, nil
+// for the unread marker or past the end. gw must be locked.
+func (gw *guiwrapper) messageAt(line int, width int) *guimessage {
+	y := 0
+	for _, msg := range gw.messages {
+		if msg == gw.marker {
+			if line == y {
+				return nil
+			}
+			y++
+		}
+		y += wrappedLines(stripANSI(gw.formatMessage(msg)), width)
+		if line < y {
+			return msg
+		}
+	}
+	return nil
+}
+
+func (gw *guiwrapper) markerLine(width int) string {
+	label := " new messages "
+	side := (width - len(label)) / 2
+	if side < 1 {
+		side = 1
+	}
+	line := strings.Repeat("─", side) + label + strings.Repeat("─", side)
+	return fmt.Sprintf("%s%s%s", gw.theme.get("unread"), line, reset)
+}
+
+// title of the "messages" view, counts the new messages while scrolled up. gw must be locked.
+func (gw *guiwrapper) title() string {
+	title := " messages"
+	if gw.private {
+		title = fmt.Sprintf(" whispers with %s", gw.name)
+	}
+	if gw.scrolledUp && gw.newMessages > 0 {
+		return fmt.Sprintf("%s (%d new messages): ", title, gw.newMessages)
+	}
+	return title + ": "
+}
+
+func (gw *guiwrapper) renderTitle() {
+	gw.gui.Update(func(g *gocui.Gui) error {
+		messageView, err := g.View("messages")
+		if err != nil {
+			return err
+		}
+		gw.RLock()
+		defer gw.RUnlock()
+		if gw.active {
+			messageView.Title = gw.title()
+		}
+		return nil
+	})
+}
+
+// markUnread puts the unread marker in front of the next message.
+func (gw *guiwrapper) markUnread() {
+	gw.Lock()
+	gw.markPending = true
+	gw.Unlock()
+}
+
 func (gw *guiwrapper) addMessage(m guimessage) {
 
 	gw.Lock()
@@ -74,19 +207,61 @@ func (gw *guiwrapper) addMessage(m guimessage) {
 	} else {
 		gw.messages = append(gw.messages, &m)
 	}
+	if gw.markPending {
+		gw.marker = &m
+		gw.markPending = false
+	}
+	active := gw.active
+	if !active {
+		gw.unread++
+	}
+	scrolledUp := active && gw.scrolledUp
+	if scrolledUp {
+		gw.newMessages++
+	}
 	gw.Unlock()
+
+	if !active && gw.onUnread != nil {
+		gw.onUnread()
+		return
+	}
+	if scrolledUp {
+		gw.renderTitle()
+	}
 	gw.redraw()
 }
 
-//currently not in use
-func (gw *guiwrapper) applyTag(tag string, nick string) {
-
+// restyle renders all messages again, after the theme or the tags changed.
+// The styles don't change the length of a line, a scrolled up view keeps its origin.
+func (gw *guiwrapper) restyle() {
 	gw.Lock()
-	defer gw.Unlock()
-
 	for _, m := range gw.messages {
-		if m.nick != "" && strings.EqualFold(m.nick, nick) {
-			m.tag = tag
+		if m.style != nil {
+			m.tag, m.msg = m.style()
 		}
 	}
+	gw.Unlock()
+
+	gw.gui.Update(func(g *gocui.Gui) error {
+		messageView, err := g.View("messages")
+		if err != nil {
+			return err
+		}
+
+		gw.RLock()
+		defer gw.RUnlock()
+		if !gw.active {
+			return nil
+		}
+
+		width, _ := messageView.Size()
+		content, _, _ := gw.content(width, nil)
+		_, oy := messageView.Origin()
+		messageView.Clear()
+		fmt.Fprint(messageView, content)
+		if !messageView.Autoscroll {
+			messageView.SetOrigin(0, oy)
+		}
+		return nil
+	})
 }
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+func TestUnreadMarker(t *testing.T) {
+	c := newTestChat(t, testConfig(), &fakeSession{})
+	gw := c.guiwrapper
+	gw.addMessage(guimessage{ts: time.Now(), tag: "   ", msg: "read"})
+
+	// scrolling up, like scroll() does when leaving the bottom
+	gw.Lock()
+	gw.scrolledUp = true
+	gw.markPending = true
+	gw.Unlock()
+
+	gw.addMessage(guimessage{ts: time.Now(), tag: "   ", msg: "first unread"})
+	gw.addMessage(guimessage{ts: time.Now(), tag: "   ", msg: "second unread"})
+
+	gw.RLock()
+	content, markerLine, total := gw.content(80, nil)
+	title := gw.title()
+	gw.RUnlock()
+
+	lines := strings.Split(strings.TrimSuffix(stripANSI(content), "\n"), "\n")
+	if markerLine != 1 || total != 4 || !strings.Contains(lines[1], "new messages") {
+		t.Errorf("marker at line %d of %d, content %q", markerLine, total, lines)
+	}
+	if !strings.HasSuffix(lines[2], "first unread") {
+		t.Errorf("marker not in front of the first unread message: %q", lines)
+	}
+	if title != " messages (2 new messages): " {
+		t.Errorf("title %q does not count new messages", title)
+	}
+}
+
+func TestFocusLossMarksUnread(t *testing.T) {
+	c := newTestChat(t, testConfig(), &fakeSession{})
+	c.edit(nil, gocui.KeyEsc, 0, gocui.ModNone)
+	typeKeys(c, "[O")
+	c.renderCommand("while away")
+
+	if c.input.String() != "" {
+		t.Errorf("focus event typed %q", c.input.String())
+	}
+	gw := c.guiwrapper
+	gw.RLock()
+	defer gw.RUnlock()
+	if gw.marker == nil || gw.marker != gw.messages[len(gw.messages)-1] {
+		t.Errorf("no unread marker after losing focus")
+	}
+}
+
+func TestContentDecorate(t *testing.T) {
+	c := newTestChat(t, testConfig(), &fakeSession{})
+	gw := c.guiwrapper
+	gw.addMessage(guimessage{ts: time.Now(), tag: "   ", msg: "read"})
+	gw.Lock()
+	gw.markPending = true
+	gw.Unlock()
+	gw.addMessage(guimessage{ts: time.Now(), tag: "   ", msg: "first unread"})
+	gw.addMessage(guimessage{ts: time.Now(), tag: "   ", msg: "second unread"})
+
+	gw.RLock()
+	defer gw.RUnlock()
+	// every message is drawn on the line messageAt finds it at, marker included
+	gw.content(80, func(msg *guimessage, text string, line int) string {
+		if at := gw.messageAt(line, 80); at != msg {
+			t.Errorf("%q decorated on line %d, messageAt has %v", msg.msg, line, at)
+		}
+		return text
+	})
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// headless prints events to out instead of drawing them, either in the
+// format of the chat log or as JSON Lines.
+type headless struct {
+	out  io.Writer
+	errs io.Writer // errors and command feedback, keeps out parseable
+	json bool
+	sync.Mutex
+}
+
+func (h *headless) print(e logEntry) error {
+	h.Lock()
+	defer h.Unlock()
+
+	if !h.json {
+		_, err := fmt.Fprintln(h.out, formatLogEntry(e))
+		return err
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = h.out.Write(append(b, '\n'))
+	return err
+}
+
+func (h *headless) info(s string) {
+	h.Lock()
+	defer h.Unlock()
+	fmt.Fprintln(h.errs, s)
+}
+
+// printEvent is a no-op unless running headless, messages of ignored users are skipped.
+func (c *chat) printEvent(e logEntry) {
+	if c.headless == nil {
+		return
+	}
+	if e.Type == "MSG" && contains(c.config.Ignores, e.Nick) {
+		return
+	}
+
+	if err := c.headless.print(e); err != nil {
+		c.headless.info(fmt.Sprintf("error: %v", err))
+	}
+}
+
+// readInput sends every line of r like it was typed into the input view.
+func (c *chat) readInput(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		c.handleInput(line)
+	}
+	return scanner.Err()
+}
+
+// runHeadless streams chat to stdout and sends lines read from stdin until interrupted.
+// The end of stdin only stops input, so tsgg can be used as a read-only pipe.
+func runHeadless(config *config, format string) error {
+	sgg, err := newSession(config)
+	if err != nil {
+		return err
+	}
+
+	chat, err := newChat(config, noGui{}, sgg)
+	if err != nil {
+		return err
+	}
+	chat.headless = &headless{out: os.Stdout, errs: os.Stderr, json: format == "json"}
+	// the bell and escape sequences would end up in the output
+	chat.notifier.removeTerminalBackends()
+	// lines piped in by scripts would flood the history of the gui
+	chat.historyFile = ""
+
+	if config.Logging {
+		chat.chatlog, err = newChatlog(config.LogDirectory, config.CustomURL, config.LogJSON)
+		if err != nil {
+			return err
+		}
+		defer chat.chatlog.close()
+	}
+
+	// warnings are rendered, check once they are printed
+	chat.checkAliases()
+	chat.addHandlers()
+	chat.plugins.start()
+	defer chat.plugins.stop()
+
+	if config.LoadHistory {
+		chat.loadHistory(false)
+	}
+
+	err = chat.Session.Open()
+	if err != nil {
+		return err
+	}
+	defer chat.Session.Close()
+
+	go func() {
+		if err := chat.readInput(os.Stdin); err != nil {
+			chat.renderError(fmt.Sprintf("reading stdin: %v", err))
+		}
+	}()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	<-interrupt
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+func TestHeadlessOutput(t *testing.T) {
+	ts := time.Date(2020, 11, 17, 12, 30, 0, 0, time.Local)
+	events := func(s *fakeSession) {
+		s.onMessage(dggchat.Message{Sender: dggchat.User{Nick: "bob"}, Timestamp: ts, Message: "hi"}, nil)
+		s.onMessage(dggchat.Message{Sender: dggchat.User{Nick: "Troll"}, Timestamp: ts, Message: "ignore me"}, nil)
+		s.onPM(dggchat.PrivateMessage{User: dggchat.User{Nick: "alice"}, Timestamp: ts, Message: "psst"}, nil)
+		s.onMute(dggchat.Mute{Sender: dggchat.User{Nick: "mod"}, Target: dggchat.User{Nick: "bob"}, Timestamp: ts}, nil)
+		s.onJoin(dggchat.RoomAction{User: dggchat.User{Nick: "carol"}, Timestamp: ts}, nil)
+	}
+
+	tests := []struct {
+		json bool
+		want []string
+	}{
+		{false, []string{
+			"[2020-11-17 12:30:00] bob: hi",
+			"[2020-11-17 12:30:00] [PM <- alice] psst",
+			"[2020-11-17 12:30:00] bob muted by mod",
+			"[2020-11-17 12:30:00] carol joined",
+		}},
+		{true, []string{
+			`{"type":"MSG","timestamp":"` + ts.Format(time.RFC3339Nano) + `","nick":"bob","data":"hi"}`,
+			`{"type":"PRIVMSG","timestamp":"` + ts.Format(time.RFC3339Nano) + `","nick":"alice","data":"psst"}`,
+			`{"type":"MUTE","timestamp":"` + ts.Format(time.RFC3339Nano) + `","nick":"mod","target":"bob"}`,
+			`{"type":"JOIN","timestamp":"` + ts.Format(time.RFC3339Nano) + `","nick":"carol"}`,
+		}},
+	}
+
+	for _, tt := range tests {
+		cfg := testConfig()
+		cfg.Ignores = []string{"troll"}
+		s := &fakeSession{}
+		c := newTestChat(t, cfg, s)
+		var out, errs bytes.Buffer
+		c.headless = &headless{out: &out, errs: &errs, json: tt.json}
+
+		events(s)
+
+		got := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("json=%t: printed\n%s\nwant\n%s", tt.json, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+		if errs.Len() != 0 {
+			t.Errorf("json=%t: unexpected errors %q", tt.json, errs.String())
+		}
+	}
+}
+
+func TestHeadlessInput(t *testing.T) {
+	s := &fakeSession{}
+	c := newTestChat(t, testConfig(), s)
+	var out, errs bytes.Buffer
+	c.headless = &headless{out: &out, errs: &errs}
+
+	err := c.readInput(strings.NewReader("hello\n\n  /w bob hi  \n/unknown\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"MSG hello", "PRIVMSG bob hi"}
+	if sent := s.messages(); !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent %q, want %q", sent, want)
+	}
+	if !strings.Contains(out.String(), "[PM -> bob] hi") {
+		t.Errorf("sent whisper not printed: %q", out.String())
+	}
+	if got := errs.String(); got != "error: unknown command: /unknown\n" {
+		t.Errorf("errors %q", got)
+	}
+}
+
+func TestHeadlessWhisperSent(t *testing.T) {
+	s := &fakeSession{}
+	c := newTestChat(t, testConfig(), s)
+	var out, errs bytes.Buffer
+	c.headless = &headless{out: &out, errs: &errs}
+
+	s.err = errors.New("connection not established")
+	c.handleInput("/w bob lost")
+	s.err = nil
+	c.handleInput("/w bob sent")
+
+	if strings.Contains(out.String(), "lost") || !strings.Contains(out.String(), "sent") {
+		t.Errorf("printed %q, want only the whisper that was sent", out.String())
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+// types of highlight rules
+const (
+	highlightWord  = "word"
+	highlightRegex = "regex"
+	highlightNick  = "nick"
+)
+
+type highlightRule struct {
+	Pattern string `toml:"pattern"`
+	Type    string `toml:"type"`
+	Fg      string `toml:"fg"`
+	Bg      string `toml:"bg"`
+	Notify  bool   `toml:"notify"`
+
+	re *regexp.Regexp
+}
+
+// wordPattern matches word only if it is not part of a longer word,
+// unlike \b this also works for words starting or ending with symbols.
+func wordPattern(word string) string {
+	return `(?i)(^|[^\pL\pN_])` + regexp.QuoteMeta(word) + `($|[^\pL\pN_])`
+}
+
+func (r *highlightRule) compile() error {
+	if r.Type == "" {
+		r.Type = highlightWord
+	}
+	if r.Pattern == "" {
+		return errors.New("highlight pattern must not be empty")
+	}
+
+	var err error
+	switch r.Type {
+	case highlightWord:
+		r.re, err = regexp.Compile(wordPattern(r.Pattern))
+	case highlightRegex:
+		r.re, err = regexp.Compile(r.Pattern)
+	case highlightNick:
+		r.re = nil
+	default:
+		return fmt.Errorf("invalid highlight type %q, must be one of word, regex or nick", r.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid highlight %q: %v", r.Pattern, err)
+	}
+
+	for _, c := range []string{r.Fg, r.Bg} {
+		if _, err := parseColor(c); c != "" && err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *highlightRule) matches(m dggchat.Message) bool {
+	if r.Type == highlightNick {
+		return strings.EqualFold(m.Sender.Nick, r.Pattern)
+	}
+	return r.re.MatchString(m.Message)
+}
+
+func (r *highlightRule) String() string {
+	s := fmt.Sprintf("%s (%s)", r.Pattern, r.Type)
+	if r.Fg != "" {
+		s += " fg=" + r.Fg
+	}
+	if r.Bg != "" {
+		s += " bg=" + r.Bg
+	}
+	if r.Notify {
+		s += " notify"
+	}
+	return s
+}
+
+// compileHighlights builds the active highlight rules: our own nick, the plain
+// words of the highlighted list, the configured highlight_rules and the rules
+// added by plugins. The rules are copies, commands change the config while
+// messages are matched against the published rules.
+func (c *chat) compileHighlights() error {
+	c.config.RLock()
+	var rules []*highlightRule
+	if c.username != "" {
+		rules = append(rules, &highlightRule{Pattern: c.username, Notify: c.config.Notifications.Mentions})
+	}
+	for _, word := range c.config.Highlighted {
+		rules = append(rules, &highlightRule{Pattern: word})
+	}
+	for _, r := range c.config.HighlightRules {
+		r := r
+		rules = append(rules, &r)
+	}
+	c.config.RUnlock()
+
+	for _, r := range c.plugins.highlightRules() {
+		r := r
+		rules = append(rules, &r)
+	}
+
+	for _, r := range rules {
+		if err := r.compile(); err != nil {
+			return err
+		}
+	}
+
+	c.highlightMu.Lock()
+	c.highlights = rules
+	c.highlightMu.Unlock()
+	return nil
+}
+
+// highlightStyle returns the colors of rule. Rules without colors of their own use
+// the highlight theme style.
+func (c *chat) highlightStyle(r *highlightRule) color {
+	if r.Fg == "" && r.Bg == "" {
+		return c.theme.get("highlight")
+	}
+
+	spec := r.Fg
+	if r.Bg != "" {
+		spec += " on " + r.Bg
+	}
+	style, _ := parseStyle(spec) // validated in compile
+	return style
+}
+
+// highlightFor returns the first highlight rule matching m, or nil.
+func (c *chat) highlightFor(m dggchat.Message) *highlightRule {
+	c.highlightMu.RLock()
+	defer c.highlightMu.RUnlock()
+
+	for _, r := range c.highlights {
+		if r.matches(m) {
+			return r
+		}
+	}
+	return nil
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+const (
+	historyAttempts = 3
+	historyBackoff  = time.Second
+)
+
+// historyLoader fetches the chat history endpoint. Besides the initial load it
+// remembers the newest message seen on the socket, so the gap that opens while
+// the socket is reconnecting can be filled in afterwards.
+type historyLoader struct {
+	url    string
+	client http.Client
+
+	disconnected bool
+	lastSeen     time.Time
+	// messages sharing lastSeen's timestamp, the endpoint only has second precision
+	seenAtLast map[string]bool
+
+	// while backfilling, the gap starts at the last message seen before the
+	// reconnect and live messages arriving meanwhile are not backfilled again
+	backfills    int
+	cutoff       time.Time
+	seenAtCutoff map[string]bool
+	seenSocket   map[string]bool
+	sync.Mutex
+}
+
+// history events share the wire format of the websocket, e.g. `MSG {"nick":...}`
+type historyEvent struct {
+	Nick      string   `json:"nick"`
+	Features  []string `json:"features"`
+	Timestamp int64    `json:"timestamp"`
+	Data      string   `json:"data"`
+}
+
+func newHistoryLoader(url string) *historyLoader {
+	return &historyLoader{
+		url:        url,
+		client:     http.Client{Timeout: time.Second * 2},
+		seenAtLast: make(map[string]bool),
+	}
+}
+
+func (h *historyLoader) fetch() ([]string, error) {
+	req, err := http.NewRequest(http.MethodGet, h.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "tsgg")
+
+	res, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("history endpoint status code %d", res.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var received []string
+	err = json.Unmarshal(body, &received)
+	if err != nil {
+		return nil, err
+	}
+	return received, nil
+}
+
+// fetchWithRetry retries failed requests with exponential backoff.
+func (h *historyLoader) fetchWithRetry() ([]string, error) {
+	var err error
+	wait := historyBackoff
+	for attempt := 1; ; attempt++ {
+		var received []string
+		received, err = h.fetch()
+		if err == nil {
+			return received, nil
+		}
+		if attempt == historyAttempts {
+			break
+		}
+		time.Sleep(wait)
+		wait *= 2
+	}
+	return nil, err
+}
+
+func messageKey(m dggchat.Message) string {
+	return m.Sender.Nick + " " + m.Message
+}
+
+// socketKey identifies a message received on the socket during a backfill.
+func socketKey(ts time.Time, key string) string {
+	return fmt.Sprintf("%d %s", ts.Unix(), key)
+}
+
+// markSeen records a message received on the socket.
+func (h *historyLoader) markSeen(m dggchat.Message) {
+	h.Lock()
+	defer h.Unlock()
+
+	if h.backfills > 0 {
+		h.seenSocket[socketKey(m.Timestamp, messageKey(m))] = true
+	}
+	h.advance(m)
+}
+
+// markLoaded records a message loaded from the history endpoint.
+func (h *historyLoader) markLoaded(m dggchat.Message) {
+	h.Lock()
+	defer h.Unlock()
+	h.advance(m)
+}
+
+func (h *historyLoader) advance(m dggchat.Message) {
+	if m.Timestamp.After(h.lastSeen) {
+		h.lastSeen = m.Timestamp
+		h.seenAtLast = make(map[string]bool)
+	}
+	if m.Timestamp.Equal(h.lastSeen) {
+		h.seenAtLast[messageKey(m)] = true
+	}
+}
+
+// isNew reports whether an event from the history endpoint happened after the
+// last message seen on the socket before the backfill started.
+func (h *historyLoader) isNew(ts time.Time, key string) bool {
+	h.Lock()
+	defer h.Unlock()
+
+	last, seenAtLast := h.lastSeen, h.seenAtLast
+	if h.backfills > 0 {
+		if key != "" && h.seenSocket[socketKey(ts, key)] {
+			return false
+		}
+		last, seenAtLast = h.cutoff, h.seenAtCutoff
+	}
+	if last.IsZero() {
+		return true
+	}
+	return ts.After(last) || (ts.Equal(last) && key != "" && !seenAtLast[key])
+}
+
+func (h *historyLoader) setDisconnected() {
+	h.Lock()
+	defer h.Unlock()
+	h.disconnected = true
+}
+
+// reconnected returns true once after the socket was disconnected and starts
+// a backfill, finish it with endBackfill.
+func (h *historyLoader) reconnected() bool {
+	h.Lock()
+	defer h.Unlock()
+	r := h.disconnected
+	h.disconnected = false
+	if !r {
+		return false
+	}
+
+	// a backfill still running covers the earlier gap as well
+	if h.backfills == 0 {
+		h.cutoff = h.lastSeen
+		h.seenAtCutoff = make(map[string]bool, len(h.seenAtLast))
+		for k := range h.seenAtLast {
+			h.seenAtCutoff[k] = true
+		}
+		h.seenSocket = make(map[string]bool)
+	}
+	h.backfills++
+	return true
+}
+
+func (h *historyLoader) endBackfill() {
+	h.Lock()
+	defer h.Unlock()
+	h.backfills--
+	if h.backfills == 0 {
+		h.seenAtCutoff, h.seenSocket = nil, nil
+	}
+}
+
+// loadHistory renders the history endpoint into the main buffer. Failures
+// are rendered as errors instead of stopping tsgg. If backfill is set, only
+// events newer than the last message seen on the socket are rendered.
+// The initial load blocks startup, it is not retried.
+func (c *chat) loadHistory(backfill bool) {
+	fetch := c.history.fetch
+	if backfill {
+		defer c.history.endBackfill()
+		fetch = c.history.fetchWithRetry
+	}
+	received, err := fetch()
+	if err != nil {
+		c.renderError(fmt.Sprintf("could not load chat history: %v", err))
+		return
+	}
+
+	var failed int
+	for _, line := range received {
+		err := c.renderHistoryEvent(line, backfill)
+		if err != nil {
+			failed++
+			c.renderDebug(fmt.Sprintf("history: %v: %q", err, line))
+		}
+	}
+	if failed > 0 {
+		c.renderError(fmt.Sprintf("skipped %d malformed chat history lines", failed))
+	}
+}
+
+func (c *chat) renderHistoryEvent(line string, backfill bool) error {
+	mslice := strings.SplitN(line, " ", 2)
+	if len(mslice) != 2 {
+		return errors.New("missing event type")
+	}
+
+	var e historyEvent
+	err := json.Unmarshal([]byte(mslice[1]), &e)
+	if err != nil {
+		return err
+	}
+
+	user := dggchat.User{
+		Nick:     e.Nick,
+		Features: e.Features,
+	}
+	ts := time.Unix(e.Timestamp/1000, 0)
+	// mod actions target the nick given in data
+	target := dggchat.User{Nick: e.Data}
+
+	// the initial history was logged when it happened
+	logBackfill := func(entry logEntry) {
+		if backfill {
+			c.logEvent(entry)
+		} else {
+			c.printEvent(entry)
+		}
+	}
+
+	if mslice[0] == "MSG" {
+		m := dggchat.Message{Sender: user, Timestamp: ts, Message: e.Data}
+		if backfill && !c.history.isNew(ts, messageKey(m)) {
+			return nil
+		}
+		c.history.markLoaded(m)
+		logBackfill(messageEntry(m))
+		c.renderMessage(m, false)
+		return nil
+	}
+
+	if backfill && !c.history.isNew(ts, "") {
+		return nil
+	}
+
+	switch mslice[0] {
+	case "MUTE", "UNMUTE":
+		mute := dggchat.Mute{Sender: user, Timestamp: ts, Target: target}
+		logBackfill(muteEntry(mslice[0], mute))
+		if mslice[0] == "MUTE" {
+			c.renderMute(mute)
+		} else {
+			c.renderUnmute(mute)
+		}
+	case "BAN", "UNBAN":
+		ban := dggchat.Ban{Sender: user, Timestamp: ts, Target: target}
+		logBackfill(banEntry(mslice[0], ban))
+		if mslice[0] == "BAN" {
+			c.renderBan(ban)
+		} else {
+			c.renderUnban(ban)
+		}
+	case "BROADCAST":
+		b := dggchat.Broadcast{Sender: user, Timestamp: ts, Message: e.Data}
+		logBackfill(broadcastEntry(b))
+		c.renderBroadcast(b)
+	case "SUBONLY":
+		so := dggchat.SubOnly{Sender: user, Timestamp: ts, Active: e.Data == "on"}
+		logBackfill(subOnlyEntry(so))
+		c.renderSubOnly(so)
+	case "JOIN", "QUIT":
+		r := dggchat.RoomAction{User: user, Timestamp: ts}
+		logBackfill(roomActionEntry(mslice[0], r))
+		if mslice[0] == "JOIN" {
+			c.renderJoin(r, false)
+		} else {
+			c.renderQuit(r)
+		}
+	default:
+		c.renderDebug(fmt.Sprintf("history: ignoring %s event", mslice[0]))
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+func TestBackfill(t *testing.T) {
+	start := time.Now().Truncate(time.Second)
+	at := func(s int) time.Time { return start.Add(time.Duration(s) * time.Second) }
+	msg := func(s int, text string) dggchat.Message {
+		return dggchat.Message{Sender: dggchat.User{Nick: "bob"}, Timestamp: at(s), Message: text}
+	}
+
+	var history []string
+	for i, text := range []string{"before", "missed", "live"} {
+		e, _ := json.Marshal(historyEvent{Nick: "bob", Timestamp: at(i).UnixNano() / int64(time.Millisecond), Data: text})
+		history = append(history, fmt.Sprintf("MSG %s", e))
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(history)
+	}))
+	defer srv.Close()
+
+	s := &fakeSession{}
+	c := newTestChat(t, testConfig(), s)
+	c.history = newHistoryLoader(srv.URL)
+
+	s.onMessage(msg(0, "before"), nil)
+	c.history.setDisconnected()
+	if !c.history.reconnected() {
+		t.Fatal("reconnect not noticed")
+	}
+	// arrives on the socket while the history is fetched
+	s.onMessage(msg(2, "live"), nil)
+	c.loadHistory(true)
+
+	for text, want := range map[string]int{"before": 1, "missed": 1, "live": 1} {
+		if n := countLines(c.guiwrapper, "bob: "+text); n != want {
+			t.Errorf("%q rendered %d times, want %d: %q", text, n, want, lines(c.guiwrapper))
+		}
+	}
+
+	// the next backfill starts after the newest message
+	c.history.setDisconnected()
+	c.history.reconnected()
+	c.loadHistory(true)
+	if n := len(lines(c.guiwrapper)); n != 3 {
+		t.Errorf("second backfill rendered again: %q", lines(c.guiwrapper))
+	}
+}
+
+func TestInitialLoadNoRetry(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c := newTestChat(t, testConfig(), &fakeSession{})
+	c.history = newHistoryLoader(srv.URL)
+	c.loadHistory(false)
+
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("initial load made %d requests, want 1", n)
+	}
+	if countLines(c.guiwrapper, "could not load chat history") != 1 {
+		t.Errorf("failure not rendered: %q", lines(c.guiwrapper))
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+const defaultInputHistorySize = 1000
+
+// historySearch is the state of the reverse incremental search (ctrl+r)
+// through the input history.
+type historySearch struct {
+	query    string
+	index    int    // index of the match in messageHistory, -1 if none
+	failed   bool   // the query has no match, the previous match is kept
+	original string // input before the search, restored on cancel
+}
+
+// addHistory puts message in front of history, removing older copies of it.
+func addHistory(history []string, message string, size int) []string {
+	updated := make([]string, 0, len(history)+1)
+	updated = append(updated, message)
+	for _, m := range history {
+		if m != message {
+			updated = append(updated, m)
+		}
+	}
+	if len(updated) > size {
+		updated = updated[:size]
+	}
+	return updated
+}
+
+// loadInputHistory reads the history file, oldest entry first, and returns the
+// entries newest first. A missing file is an empty history.
+func loadInputHistory(file string, size int) ([]string, error) {
+	history := []string{}
+	if file == "" {
+		return history, nil
+	}
+
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return history, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			history = addHistory(history, line, size)
+		}
+	}
+	return history, scanner.Err()
+}
+
+func saveInputHistory(file string, history []string) error {
+	var buf strings.Builder
+	for i := len(history) - 1; i >= 0; i-- {
+		buf.WriteString(history[i] + "\n")
+	}
+	return ioutil.WriteFile(file, []byte(buf.String()), 0600)
+}
+
+// rememberInput adds a sent message to the input history and saves it.
+func (c *chat) rememberInput(message string) {
+	c.messageHistory = addHistory(c.messageHistory, message, c.historySize)
+	c.historyIndex = -1
+
+	if c.historyFile == "" {
+		return
+	}
+	if err := saveInputHistory(c.historyFile, c.messageHistory); err != nil {
+		c.renderError(fmt.Sprintf("saving input history: %v", err))
+	}
+}
+
+// findHistory returns the index of the first entry from index on containing query, or -1.
+func (c *chat) findHistory(query string, index int) int {
+	query = strings.ToLower(query)
+	for i := index; i < len(c.messageHistory); i++ {
+		if strings.Contains(strings.ToLower(c.messageHistory[i]), query) {
+			return i
+		}
+	}
+	return -1
+}
+
+// searchHistory starts a reverse search, or jumps to the next older match while searching.
+func (c *chat) searchHistory() {
+	s := c.historySearch
+	if s == nil {
+		c.historySearch = &historySearch{index: -1, original: c.input.String()}
+		return
+	}
+	if s.index == -1 {
+		return
+	}
+	if i := c.findHistory(s.query, s.index+1); i != -1 {
+		c.showHistoryMatch(i)
+	}
+}
+
+// newerHistoryMatch jumps to the next newer match of the search.
+func (c *chat) newerHistoryMatch() {
+	s := c.historySearch
+	query := strings.ToLower(s.query)
+	for i := s.index - 1; i >= 0; i-- {
+		if strings.Contains(strings.ToLower(c.messageHistory[i]), query) {
+			c.showHistoryMatch(i)
+			return
+		}
+	}
+}
+
+func (c *chat) showHistoryMatch(i int) {
+	c.historySearch.index = i
+	c.input.set(c.messageHistory[i])
+}
+
+// setHistoryQuery updates the query and shows the newest match.
+func (c *chat) setHistoryQuery(query string) {
+	s := c.historySearch
+	s.query = query
+	if query == "" {
+		s.index, s.failed = -1, false
+		c.input.set(s.original)
+		return
+	}
+
+	i := c.findHistory(query, 0)
+	s.failed = i == -1
+	if !s.failed {
+		c.showHistoryMatch(i)
+	}
+}
+
+// acceptHistorySearch ends the search, keeping the match in the input view for editing.
+func (c *chat) acceptHistorySearch() {
+	c.historySearch = nil
+	c.historyIndex = -1
+}
+
+func (c *chat) cancelHistorySearch() {
+	c.input.set(c.historySearch.original)
+	c.historySearch = nil
+}
+
+// editHistorySearch handles keys while searching, other keys accept the match
+// and are handled by the editor.
+func (c *chat) editHistorySearch(key gocui.Key, ch rune) bool {
+	s := c.historySearch
+	switch {
+	case key == gocui.KeyEsc || key == gocui.KeyCtrlG:
+		c.cancelHistorySearch()
+	case ch != 0:
+		c.setHistoryQuery(s.query + string(ch))
+	case key == gocui.KeySpace:
+		c.setHistoryQuery(s.query + " ")
+	case key == gocui.KeyBackspace || key == gocui.KeyBackspace2:
+		if q := []rune(s.query); len(q) > 0 {
+			c.setHistoryQuery(string(q[:len(q)-1]))
+		}
+	default:
+		c.acceptHistorySearch()
+		return false
+	}
+	return true
+}
+
+func (c *chat) historySearchTitle() string {
+	s := c.historySearch
+	if s.failed {
+		return fmt.Sprintf(" history search: no match for %s (esc to cancel) ", s.query)
+	}
+	return fmt.Sprintf(" history search: %s (ctrl+r older, enter to accept, esc to cancel) ", s.query)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+func TestInputHistoryPersistence(t *testing.T) {
+	cfg := testConfig()
+	cfg.InputHistory = filepath.Join(t.TempDir(), "history.txt")
+	cfg.InputHistorySize = 3
+
+	c := newTestChat(t, cfg, &fakeSession{})
+	for _, m := range []string{"one", "two", "one", "three", "four"} {
+		c.handleInput(m)
+	}
+	if want := []string{"four", "three", "one"}; !reflect.DeepEqual(c.messageHistory, want) {
+		t.Errorf("history %q, want %q", c.messageHistory, want)
+	}
+
+	c = newTestChat(t, cfg, &fakeSession{})
+	if want := []string{"four", "three", "one"}; !reflect.DeepEqual(c.messageHistory, want) {
+		t.Errorf("loaded history %q, want %q", c.messageHistory, want)
+	}
+}
+
+func TestHistorySearch(t *testing.T) {
+	c := newTestChat(t, testConfig(), &fakeSession{})
+	for _, m := range []string{"hello world", "bye", "hello there"} {
+		c.handleInput(m)
+	}
+	typeKeys(c, "draft")
+
+	c.searchHistory()
+	typeKeys(c, "hel")
+	if got := c.input.String(); got != "hello there" {
+		t.Errorf("newest match %q, want %q", got, "hello there")
+	}
+
+	c.searchHistory()
+	if got := c.input.String(); got != "hello world" {
+		t.Errorf("older match %q, want %q", got, "hello world")
+	}
+
+	typeKeys(c, "x")
+	if !c.historySearch.failed || c.input.String() != "hello world" {
+		t.Errorf("failed search changed the match to %q", c.input.String())
+	}
+
+	c.edit(nil, gocui.KeyEsc, 0, gocui.ModNone)
+	if c.historySearch != nil || c.input.String() != "draft" {
+		t.Errorf("cancel restored %q, want %q", c.input.String(), "draft")
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// defaultKeybindings are used for every action not set in the [keybindings] config table.
+var defaultKeybindings = map[string]string{
+	"quit":             "ctrl+c",
+	"toggle_help":      "f1",
+	"toggle_users":     "f2",
+	"toggle_debug":     "f12",
+	"next_tab":         "ctrl+n",
+	"previous_tab":     "ctrl+p",
+	"search":           "ctrl+f",
+	"links":            "f3",
+	"jump_unread":      "f4",
+	"moderation":       "f5",
+	"select":           "f6",
+	"scroll_page_up":   "pgup",
+	"scroll_page_down": "pgdn",
+	"history_up":       "up",
+	"history_down":     "down",
+	"history_search":   "ctrl+r",
+	"tab_complete":     "tab",
+	"send":             "enter",
+}
+
+var keyNames = map[string]gocui.Key{
+	"f1":         gocui.KeyF1,
+	"f2":         gocui.KeyF2,
+	"f3":         gocui.KeyF3,
+	"f4":         gocui.KeyF4,
+	"f5":         gocui.KeyF5,
+	"f6":         gocui.KeyF6,
+	"f7":         gocui.KeyF7,
+	"f8":         gocui.KeyF8,
+	"f9":         gocui.KeyF9,
+	"f10":        gocui.KeyF10,
+	"f11":        gocui.KeyF11,
+	"f12":        gocui.KeyF12,
+	"insert":     gocui.KeyInsert,
+	"delete":     gocui.KeyDelete,
+	"home":       gocui.KeyHome,
+	"end":        gocui.KeyEnd,
+	"pgup":       gocui.KeyPgup,
+	"pageup":     gocui.KeyPgup,
+	"pgdn":       gocui.KeyPgdn,
+	"pagedown":   gocui.KeyPgdn,
+	"up":         gocui.KeyArrowUp,
+	"down":       gocui.KeyArrowDown,
+	"left":       gocui.KeyArrowLeft,
+	"right":      gocui.KeyArrowRight,
+	"tab":        gocui.KeyTab,
+	"enter":      gocui.KeyEnter,
+	"esc":        gocui.KeyEsc,
+	"escape":     gocui.KeyEsc,
+	"space":      gocui.KeySpace,
+	"backspace":  gocui.KeyBackspace2,
+	"ctrl+space": gocui.KeyCtrlSpace,
+	"ctrl+a":     gocui.KeyCtrlA,
+	"ctrl+b":     gocui.KeyCtrlB,
+	"ctrl+c":     gocui.KeyCtrlC,
+	"ctrl+d":     gocui.KeyCtrlD,
+	"ctrl+e":     gocui.KeyCtrlE,
+	"ctrl+f":     gocui.KeyCtrlF,
+	"ctrl+g":     gocui.KeyCtrlG,
+	"ctrl+h":     gocui.KeyCtrlH,
+	"ctrl+j":     gocui.KeyCtrlJ,
+	"ctrl+k":     gocui.KeyCtrlK,
+	"ctrl+l":     gocui.KeyCtrlL,
+	"ctrl+n":     gocui.KeyCtrlN,
+	"ctrl+o":     gocui.KeyCtrlO,
+	"ctrl+p":     gocui.KeyCtrlP,
+	"ctrl+q":     gocui.KeyCtrlQ,
+	"ctrl+r":     gocui.KeyCtrlR,
+	"ctrl+s":     gocui.KeyCtrlS,
+	"ctrl+t":     gocui.KeyCtrlT,
+	"ctrl+u":     gocui.KeyCtrlU,
+	"ctrl+v":     gocui.KeyCtrlV,
+	"ctrl+w":     gocui.KeyCtrlW,
+	"ctrl+x":     gocui.KeyCtrlX,
+	"ctrl+y":     gocui.KeyCtrlY,
+	"ctrl+z":     gocui.KeyCtrlZ,
+}
+
+type keybinding struct {
+	spec string
+	key  gocui.Key
+	mod  gocui.Modifier
+}
+
+// parseKey parses key specs like "f1", "ctrl+n" or "alt+up".
+// Plain characters are rejected, they would never reach a keybinding
+// because gocui types them into the input view.
+func parseKey(spec string) (keybinding, error) {
+	s := strings.ToLower(strings.TrimSpace(spec))
+	kb := keybinding{spec: s, mod: gocui.ModNone}
+
+	if strings.HasPrefix(s, "alt+") {
+		kb.mod = gocui.ModAlt
+		s = strings.TrimPrefix(s, "alt+")
+	}
+
+	key, ok := keyNames[s]
+	if !ok {
+		if len([]rune(s)) == 1 {
+			return kb, fmt.Errorf("%q: plain characters cannot be bound, use a function, arrow or ctrl key", spec)
+		}
+		return kb, fmt.Errorf("%q: unknown key", spec)
+	}
+	kb.key = key
+	return kb, nil
+}
+
+// parseKeybindings merges the configured keybindings with the defaults.
+// Values may list several keys separated by commas, e.g. "ctrl+n, alt+right".
+func parseKeybindings(configured map[string]string) (map[string][]keybinding, error) {
+	specs := make(map[string]string, len(defaultKeybindings))
+	for action, spec := range defaultKeybindings {
+		specs[action] = spec
+	}
+	for action, spec := range configured {
+		if _, ok := defaultKeybindings[action]; !ok {
+			return nil, fmt.Errorf("unknown action %q, valid actions are: %s", action, strings.Join(keybindingActions(), ", "))
+		}
+		specs[action] = spec
+	}
+
+	bindings := make(map[string][]keybinding, len(specs))
+	used := make(map[keybinding]string)
+	for _, action := range keybindingActions() {
+		for _, spec := range strings.Split(specs[action], ",") {
+			if strings.TrimSpace(spec) == "" {
+				continue
+			}
+			kb, err := parseKey(spec)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", action, err)
+			}
+
+			id := keybinding{key: kb.key, mod: kb.mod}
+			if other, ok := used[id]; ok {
+				return nil, fmt.Errorf("%s: %q is already bound to %s", action, kb.spec, other)
+			}
+			used[id] = action
+			bindings[action] = append(bindings[action], kb)
+		}
+	}
+	return bindings, nil
+}
+
+func keybindingActions() []string {
+	actions := make([]string, 0, len(defaultKeybindings))
+	for action := range defaultKeybindings {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	return actions
+}
+
+type keyAction struct {
+	view    string
+	handler func(*gocui.Gui, *gocui.View) error
+}
+
+func (c *chat) keyActions() map[string]keyAction {
+	return map[string]keyAction{
+		"quit":         {"", quit},
+		"toggle_help":  {"", c.showHelp},
+		"toggle_users": {"", c.showUserList},
+		"toggle_debug": {"", c.showDebug},
+		"next_tab":     {"", c.nextBuffer},
+		"previous_tab": {"", c.previousBuffer},
+		"search":       {"", c.openSearch},
+		"links":        {"", c.toggleLinks},
+		"jump_unread":  {"", c.jumpToUnread},
+		"moderation":   {"", c.toggleModeration},
+		"select":       {"", c.startSelection},
+		"scroll_page_up": {"", func(g *gocui.Gui, v *gocui.View) error {
+			return scroll(g, -c.config.PageUpDownSpeed, c, "messages")
+		}},
+		"scroll_page_down": {"", func(g *gocui.Gui, v *gocui.View) error {
+			return scroll(g, c.config.PageUpDownSpeed, c, "messages")
+		}},
+		"history_up":   {"input", c.historyUp},
+		"history_down": {"input", c.historyDown},
+		"history_search": {"input", func(g *gocui.Gui, v *gocui.View) error {
+			c.searchHistory()
+			return nil
+		}},
+		"tab_complete": {"input", func(g *gocui.Gui, v *gocui.View) error {
+			// pasted tabs are not completions
+			if c.input.isPaste(time.Now()) {
+				c.input.insert(' ')
+				return nil
+			}
+			if c.historySearch != nil {
+				c.acceptHistorySearch()
+				return nil
+			}
+			c.complete()
+			return nil
+		}},
+		"send": {"input", c.sendInput},
+	}
+}
+
+func (c *chat) setKeybindings(g *gocui.Gui, bindings map[string][]keybinding) error {
+	actions := c.keyActions()
+	for action, kbs := range bindings {
+		a := actions[action]
+		for _, kb := range kbs {
+			if err := g.SetKeybinding(a.view, kb.key, kb.mod, a.handler); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// the link picker keeps this many links
+const maxLinks = 100
+
+var urlPattern = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"]+`)
+
+type link struct {
+	url  string
+	nick string
+	ts   time.Time
+}
+
+// linkList holds the links posted in chat, newest first.
+type linkList struct {
+	links    []link
+	selected int // line selected in the link picker
+	sync.Mutex
+}
+
+// findURLs returns the positions of the links in s, without trailing punctuation.
+func findURLs(s string) [][]int {
+	matches := urlPattern.FindAllStringIndex(s, -1)
+	for _, m := range matches {
+		for m[1] > m[0] && strings.ContainsRune(".,;:!?)]}'", rune(s[m[1]-1])) {
+			// keep closing parens that belong to the url, like in wikipedia links
+			if s[m[1]-1] == ')' && strings.Count(s[m[0]:m[1]], "(") >= strings.Count(s[m[0]:m[1]], ")") {
+				break
+			}
+			m[1]--
+		}
+	}
+	return matches
+}
+
+func extractURLs(s string) []string {
+	var urls []string
+	for _, m := range findURLs(s) {
+		urls = append(urls, s[m[0]:m[1]])
+	}
+	return urls
+}
+
+// formatText styles the links and emotes of a message.
+func (c *chat) formatText(message string, after color) string {
+	return c.formatEmotes(formatLinks(message, after), after)
+}
+
+// formatLinks underlines the links in a message, after is the style the
+// message continues with after a link.
+func formatLinks(message string, after color) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range findURLs(message) {
+		b.WriteString(message[last:m[0]])
+		fmt.Fprintf(&b, "%s%s%s%s", Underline, message[m[0]:m[1]], reset, after)
+		last = m[1]
+	}
+	b.WriteString(message[last:])
+	return b.String()
+}
+
+// add collects the links of a message for the link picker.
+func (l *linkList) add(nick string, ts time.Time, message string) {
+	urls := extractURLs(message)
+	if len(urls) == 0 {
+		return
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	for _, u := range urls {
+		l.links = append([]link{{url: u, nick: nick, ts: ts}}, l.links...)
+	}
+	if len(l.links) > maxLinks {
+		l.links = l.links[:maxLinks]
+	}
+}
+
+// get returns link n, counting from 1 for the newest link.
+func (l *linkList) get(n int) (link, error) {
+	l.Lock()
+	defer l.Unlock()
+	if n < 1 || n > len(l.links) {
+		return link{}, fmt.Errorf("no link %d, %d links posted", n, len(l.links))
+	}
+	return l.links[n-1], nil
+}
+
+func defaultLinkOpener() []string {
+	switch runtime.GOOS {
+	case "darwin":
+		return []string{"open"}
+	case "windows":
+		return []string{"rundll32", "url.dll,FileProtocolHandler"}
+	default:
+		return []string{"xdg-open"}
+	}
+}
+
+// openLink runs the link_opener command, {url} is replaced by the link or
+// the link is appended if the command doesn't contain it.
+func (c *chat) openLink(url string) error {
+	opener := c.config.LinkOpener
+	if len(opener) == 0 {
+		opener = defaultLinkOpener()
+	}
+
+	args := make([]string, 0, len(opener)+1)
+	replaced := false
+	for _, a := range opener {
+		if strings.Contains(a, "{url}") {
+			a = strings.Replace(a, "{url}", url, -1)
+			replaced = true
+		}
+		args = append(args, a)
+	}
+	if !replaced {
+		args = append(args, url)
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+// copyText puts text into the clipboard with OSC 52, the terminal has to allow it.
+func (c *chat) copyText(text string) {
+	c.terminal.write(fmt.Sprintf("\u001b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text))))
+}
+
+// linkNumber parses the optional link number of /open and /copy.
+func linkNumber(tokens []string) (int, error) {
+	if len(tokens) < 2 {
+		return 1, nil
+	}
+	n, err := strconv.Atoi(tokens[1])
+	if err != nil {
+		return 0, errors.New("link number must be a number")
+	}
+	return n, nil
+}
+
+func openLinkCommand(c *chat, tokens []string) error {
+	n, err := linkNumber(tokens)
+	if err != nil {
+		return err
+	}
+	l, err := c.links.get(n)
+	if err != nil {
+		return err
+	}
+	c.renderCommand(fmt.Sprintf("Opening %s", l.url))
+	return c.openLink(l.url)
+}
+
+func copyLinkCommand(c *chat, tokens []string) error {
+	if c.headless != nil {
+		return errors.New("/copy needs a terminal")
+	}
+	n, err := linkNumber(tokens)
+	if err != nil {
+		return err
+	}
+	l, err := c.links.get(n)
+	if err != nil {
+		return err
+	}
+	c.copyText(l.url)
+	c.renderCommand(fmt.Sprintf("Copied %s", l.url))
+	return nil
+}
+
+func (c *chat) toggleLinks(g *gocui.Gui, v *gocui.View) error {
+	linkView, err := g.View("links")
+	if err != nil {
+		return err
+	}
+	if linkView.Visible {
+		return c.closeLinks(g, v)
+	}
+
+	c.links.Lock()
+	c.links.selected = 0
+	c.links.Unlock()
+
+	linkView.Visible = true
+	if _, err := g.SetViewOnTop("links"); err != nil {
+		return err
+	}
+	c.drawLinks(linkView)
+	_, err = g.SetCurrentView("links")
+	return err
+}
+
+func (c *chat) closeLinks(g *gocui.Gui, v *gocui.View) error {
+	linkView, err := g.View("links")
+	if err != nil {
+		return err
+	}
+	linkView.Visible = false
+	_, err = g.SetCurrentView("input")
+	return err
+}
+
+func (c *chat) selectLink(dy int) func(*gocui.Gui, *gocui.View) error {
+	return func(g *gocui.Gui, v *gocui.View) error {
+		c.links.Lock()
+		c.links.selected += dy
+		if c.links.selected >= len(c.links.links) {
+			c.links.selected = len(c.links.links) - 1
+		}
+		if c.links.selected < 0 {
+			c.links.selected = 0
+		}
+		c.links.Unlock()
+		c.drawLinks(v)
+		return nil
+	}
+}
+
+func (c *chat) selectedLink() (link, error) {
+	c.links.Lock()
+	n := c.links.selected + 1
+	c.links.Unlock()
+	return c.links.get(n)
+}
+
+func (c *chat) openSelectedLink(g *gocui.Gui, v *gocui.View) error {
+	l, err := c.selectedLink()
+	if err == nil {
+		err = c.openLink(l.url)
+	}
+	if err != nil {
+		c.renderError(err.Error())
+	}
+	return c.closeLinks(g, v)
+}
+
+func (c *chat) copySelectedLink(g *gocui.Gui, v *gocui.View) error {
+	l, err := c.selectedLink()
+	if err != nil {
+		c.renderError(err.Error())
+	} else {
+		c.copyText(l.url)
+		c.renderCommand(fmt.Sprintf("Copied %s", l.url))
+	}
+	return c.closeLinks(g, v)
+}
+
+// drawLinks lists the links numbered like /open and /copy expect them.
+func (c *chat) drawLinks(v *gocui.View) {
+	c.links.Lock()
+	defer c.links.Unlock()
+
+	v.Clear()
+	v.Title = fmt.Sprintf(" links (%d): enter to open, c to copy, esc to close ", len(c.links.links))
+	if len(c.links.links) == 0 {
+		fmt.Fprint(v, "no links posted yet")
+		return
+	}
+
+	for i, l := range c.links.links {
+		line := fmt.Sprintf("%2d %s %s: %s", i+1, l.ts.Format(c.config.Timeformat), l.nick, l.url)
+		if i == c.links.selected {
+			line = fmt.Sprintf("%s%s%s", Reversed, line, reset)
+		}
+		fmt.Fprintln(v, line)
+	}
+
+	// keep the selected line visible
+	_, height := v.Size()
+	oy := 0
+	if c.links.selected >= height {
+		oy = c.links.selected - height + 1
+	}
+	v.SetOrigin(0, oy)
+}
+
+func (c *chat) setLinkKeybindings(g *gocui.Gui) error {
+	bindings := []struct {
+		key     interface{}
+		handler func(*gocui.Gui, *gocui.View) error
+	}{
+		{gocui.KeyArrowUp, c.selectLink(-1)},
+		{gocui.KeyArrowDown, c.selectLink(1)},
+		{gocui.KeyEnter, c.openSelectedLink},
+		{'c', c.copySelectedLink},
+		{gocui.KeyEsc, c.closeLinks},
+	}
+	for _, b := range bindings {
+		if err := g.SetKeybinding("links", b.key, gocui.ModNone, b.handler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
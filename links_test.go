@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+	"github.com/awesome-gocui/gocui"
+)
+
+func TestExtractURLs(t *testing.T) {
+	tests := []struct {
+		message string
+		want    []string
+	}{
+		{"look https://strims.gg.", []string{"https://strims.gg"}},
+		{"(see http://a.com/x?y=1) and https://b.org/path!", []string{"http://a.com/x?y=1", "https://b.org/path"}},
+		{"https://en.wikipedia.org/wiki/Go_(programming_language)", []string{"https://en.wikipedia.org/wiki/Go_(programming_language)"}},
+		{"no links here, www.example.com", nil},
+	}
+
+	for _, tt := range tests {
+		if got := extractURLs(tt.message); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("extractURLs(%q) = %q, want %q", tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestFormatLinks(t *testing.T) {
+	got := formatLinks("go to https://strims.gg now", fgGreen)
+	want := "go to " + string(Underline) + "https://strims.gg" + string(reset) + string(fgGreen) + " now"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestOpenLink(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "opened")
+	cfg := testConfig()
+	cfg.LinkOpener = []string{"sh", "-c", "echo {url} > " + out}
+	c := newTestChat(t, cfg, &fakeSession{})
+
+	for _, m := range []string{"first https://one.example", "then https://two.example"} {
+		c.renderMessage(dggchat.Message{Sender: dggchat.User{Nick: "bob"}, Timestamp: time.Now(), Message: m}, true)
+	}
+
+	c.handleInput("/open 2")
+	waitFor(t, "opener", func() bool {
+		b, _ := ioutil.ReadFile(out)
+		return strings.TrimSpace(string(b)) == "https://one.example"
+	})
+
+	c.handleInput("/open 3")
+	if countLines(c.guiwrapper, "no link 3, 2 links posted") != 1 {
+		t.Errorf("missing error, rendered %q", lines(c.guiwrapper))
+	}
+}
+
+// queuedGui keeps the updates until run, like the main loop does.
+type queuedGui struct {
+	updates []func(*gocui.Gui) error
+}
+
+func (q *queuedGui) Update(f func(*gocui.Gui) error) {
+	q.updates = append(q.updates, f)
+}
+
+func (q *queuedGui) run() {
+	for _, f := range q.updates {
+		f(nil)
+	}
+	q.updates = nil
+}
+
+func TestCopyLink(t *testing.T) {
+	c := newTestChat(t, testConfig(), &fakeSession{})
+	gui := &queuedGui{}
+	var out strings.Builder
+	c.terminal = &terminalWriter{gui: gui, out: &out}
+
+	c.renderMessage(dggchat.Message{Sender: dggchat.User{Nick: "bob"}, Timestamp: time.Now(), Message: "see https://one.example"}, true)
+	c.handleInput("/copy")
+	if out.Len() != 0 {
+		t.Fatalf("wrote %q outside of the main loop", out.String())
+	}
+
+	gui.run()
+	if want := "\u001b]52;c;aHR0cHM6Ly9vbmUuZXhhbXBsZQ==\a"; out.String() != want {
+		t.Errorf("wrote %q, want %q", out.String(), want)
+	}
+}
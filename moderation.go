@@ -0,0 +1,397 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// the moderation panel keeps this many mod actions
+const maxModActions = 200
+
+// the server doesn't send durations and reasons, actions we sent ourselves
+// lend theirs to the matching event if it arrives within this time
+const pendingModActionTimeout = time.Minute
+
+var errNoModTarget = errors.New("select a user in the users list, the messages or the moderation panel first")
+
+type modAction struct {
+	ts       time.Time
+	kind     string // mute, unmute, ban, unban or subonly
+	sender   string
+	target   string
+	duration time.Duration // 0 is the server default or unknown
+	reason   string
+	perm     bool
+	ip       bool
+	subonly  bool
+}
+
+// describe formats an action for the log, without the timestamp.
+func (a modAction) describe() string {
+	if a.kind == "subonly" {
+		if a.subonly {
+			return fmt.Sprintf("%s turned subonly on", a.sender)
+		}
+		return fmt.Sprintf("%s turned subonly off", a.sender)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s %s", a.sender, pastTense(a.kind), a.target)
+	switch {
+	case a.perm:
+		b.WriteString(" permanently")
+	case a.duration > 0:
+		fmt.Fprintf(&b, " for %s", a.duration)
+	}
+	if a.ip {
+		b.WriteString(" (ip)")
+	}
+	if a.reason != "" {
+		fmt.Fprintf(&b, ": %s", a.reason)
+	}
+	return b.String()
+}
+
+func pastTense(kind string) string {
+	switch kind {
+	case "mute", "unmute":
+		return kind + "d"
+	default:
+		return kind + "ned"
+	}
+}
+
+// expires returns when a mute or ban ends, ok is false if that is unknown or never.
+func (a modAction) expires() (time.Time, bool) {
+	if a.perm || a.duration <= 0 {
+		return time.Time{}, false
+	}
+	return a.ts.Add(a.duration), true
+}
+
+// modLog tracks mod actions and the users currently muted or banned by them.
+type modLog struct {
+	actions  []modAction // newest first
+	pending  map[string]modAction
+	muted    map[string]modAction
+	banned   map[string]modAction
+	target   string // nick the quick actions apply to
+	selected int    // row selected in the moderation panel
+	sync.Mutex
+}
+
+func newModLog() *modLog {
+	return &modLog{
+		pending: make(map[string]modAction),
+		muted:   make(map[string]modAction),
+		banned:  make(map[string]modAction),
+	}
+}
+
+func pendingKey(kind string, nick string) string {
+	return kind + " " + strings.ToLower(nick)
+}
+
+// expect remembers the details of an action we sent until the server confirms it.
+func (l *modLog) expect(a modAction) {
+	l.Lock()
+	defer l.Unlock()
+	a.ts = time.Now()
+	l.pending[pendingKey(a.kind, a.target)] = a
+}
+
+// record adds an action reported by the server and updates who is muted or banned.
+func (l *modLog) record(a modAction) {
+	l.Lock()
+	defer l.Unlock()
+
+	key := pendingKey(a.kind, a.target)
+	if p, ok := l.pending[key]; ok {
+		delete(l.pending, key)
+		if time.Since(p.ts) < pendingModActionTimeout {
+			a.duration, a.reason, a.perm, a.ip = p.duration, p.reason, p.perm, p.ip
+		}
+	}
+
+	l.actions = append([]modAction{a}, l.actions...)
+	if len(l.actions) > maxModActions {
+		l.actions = l.actions[:maxModActions]
+	}
+
+	nick := strings.ToLower(a.target)
+	switch a.kind {
+	case "mute":
+		l.muted[nick] = a
+	case "unmute":
+		delete(l.muted, nick)
+	case "ban":
+		l.banned[nick] = a
+	case "unban":
+		delete(l.banned, nick)
+		// unbanning lifts mutes as well
+		delete(l.muted, nick)
+	}
+}
+
+// active returns the mutes and bans in effect, bans first, and forgets expired ones.
+func (l *modLog) active(now time.Time) []modAction {
+	l.Lock()
+	defer l.Unlock()
+
+	var list []modAction
+	for _, m := range []map[string]modAction{l.banned, l.muted} {
+		for nick, a := range m {
+			if end, ok := a.expires(); ok && now.After(end) {
+				delete(m, nick)
+				continue
+			}
+			list = append(list, a)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].kind != list[j].kind {
+			return list[i].kind == "ban"
+		}
+		return list[i].ts.After(list[j].ts)
+	})
+	return list
+}
+
+func (l *modLog) isBanned(nick string) bool {
+	l.Lock()
+	defer l.Unlock()
+	_, ok := l.banned[strings.ToLower(nick)]
+	return ok
+}
+
+func (l *modLog) setTarget(nick string) {
+	l.Lock()
+	l.target = nick
+	l.Unlock()
+}
+
+func (l *modLog) getTarget() string {
+	l.Lock()
+	defer l.Unlock()
+	return l.target
+}
+
+// rows are the lines of the moderation panel that can be selected, active
+// mutes and bans followed by the log.
+func (l *modLog) rows(now time.Time) (active []modAction, log []modAction) {
+	active = l.active(now)
+	l.Lock()
+	log = append([]modAction{}, l.actions...)
+	l.Unlock()
+	return active, log
+}
+
+func (c *chat) toggleModeration(g *gocui.Gui, v *gocui.View) error {
+	modView, err := g.View("moderation")
+	if err != nil {
+		return err
+	}
+	if modView.Visible {
+		return c.closeModeration(g, v)
+	}
+
+	c.modLog.Lock()
+	c.modLog.selected = -1
+	c.modLog.Unlock()
+
+	modView.Visible = true
+	if _, err := g.SetViewOnTop("moderation"); err != nil {
+		return err
+	}
+	c.drawModeration(modView)
+	_, err = g.SetCurrentView("moderation")
+	return err
+}
+
+func (c *chat) closeModeration(g *gocui.Gui, v *gocui.View) error {
+	modView, err := g.View("moderation")
+	if err != nil {
+		return err
+	}
+	modView.Visible = false
+	_, err = g.SetCurrentView("input")
+	return err
+}
+
+// selectModRow moves the selection and makes the target of the selected row the target of the quick actions.
+func (c *chat) selectModRow(dy int) func(*gocui.Gui, *gocui.View) error {
+	return func(g *gocui.Gui, v *gocui.View) error {
+		active, log := c.modLog.rows(time.Now())
+		rows := append(active, log...)
+
+		c.modLog.Lock()
+		c.modLog.selected += dy
+		if c.modLog.selected >= len(rows) {
+			c.modLog.selected = len(rows) - 1
+		}
+		if c.modLog.selected < 0 {
+			c.modLog.selected = 0
+		}
+		if c.modLog.selected < len(rows) && rows[c.modLog.selected].target != "" {
+			c.modLog.target = rows[c.modLog.selected].target
+		}
+		c.modLog.Unlock()
+
+		c.drawModeration(v)
+		return nil
+	}
+}
+
+// modQuickAction runs a command on the target of the moderation panel.
+func (c *chat) modQuickAction(action func(nick string) error) func(*gocui.Gui, *gocui.View) error {
+	return func(g *gocui.Gui, v *gocui.View) error {
+		nick := c.modLog.getTarget()
+		if nick == "" {
+			c.renderError(errNoModTarget.Error())
+			return nil
+		}
+		if err := c.checkPrivileged("the moderation panel"); err != nil {
+			c.renderError(err.Error())
+			return nil
+		}
+		if err := action(nick); err != nil {
+			c.renderError(err.Error())
+		}
+		return nil
+	}
+}
+
+func (c *chat) quickMute(nick string) error {
+	return sendMute(c, []string{"/mute", nick})
+}
+
+// quickUnmute unbans banned users and unmutes everyone else.
+func (c *chat) quickUnmute(nick string) error {
+	if c.modLog.isBanned(nick) {
+		return sendUnban(c, []string{"/unban", nick})
+	}
+	return sendUnmute(c, []string{"/unmute", nick})
+}
+
+// quickBan bans need a reason, so the command is put into the input to finish it there.
+func (c *chat) quickBan(g *gocui.Gui, v *gocui.View) error {
+	nick := c.modLog.getTarget()
+	if nick == "" {
+		c.renderError(errNoModTarget.Error())
+		return nil
+	}
+	c.input.set(fmt.Sprintf("/ban %s ", nick))
+	if g == nil {
+		return nil
+	}
+	return c.closeModeration(g, v)
+}
+
+func (c *chat) recordModAction(a modAction) {
+	c.modLog.record(a)
+	c.renderModeration()
+}
+
+// renderModeration redraws the moderation panel if it is open.
+func (c *chat) renderModeration() {
+	c.guiwrapper.gui.Update(func(g *gocui.Gui) error {
+		modView, err := g.View("moderation")
+		if err != nil {
+			return err
+		}
+		if modView.Visible {
+			c.drawModeration(modView)
+		}
+		return nil
+	})
+}
+
+func (c *chat) drawModeration(v *gocui.View) {
+	if v == nil {
+		return
+	}
+	now := time.Now()
+	active, log := c.modLog.rows(now)
+
+	c.modLog.Lock()
+	selected, target := c.modLog.selected, c.modLog.target
+	c.modLog.Unlock()
+
+	if target == "" {
+		target = "click a user"
+	}
+	v.Clear()
+	v.Title = fmt.Sprintf(" moderation: %s | m mute, b ban, u unmute/unban, esc close ", target)
+
+	row := 0
+	line := func(s string) {
+		if row == selected {
+			s = fmt.Sprintf("%s%s%s", Reversed, s, reset)
+		}
+		fmt.Fprintln(v, s)
+		row++
+	}
+
+	fmt.Fprintf(v, "%sMuted and banned (%d)%s\n", Bold, len(active), reset)
+	for _, a := range active {
+		state := "muted"
+		if a.kind == "ban" {
+			state = "banned"
+		}
+		left := "until lifted"
+		if a.perm {
+			left = "permanently"
+		} else if end, ok := a.expires(); ok {
+			left = fmt.Sprintf("%s left", end.Sub(now).Round(time.Second))
+		}
+		s := fmt.Sprintf("  %s %s by %s, %s", a.target, state, a.sender, left)
+		if a.reason != "" {
+			s += ": " + a.reason
+		}
+		line(s)
+	}
+
+	fmt.Fprintf(v, "%sRecent actions%s\n", Bold, reset)
+	for _, a := range log {
+		line(fmt.Sprintf("  %s %s", a.ts.Format(c.config.Timeformat), a.describe()))
+	}
+
+	// keep the selected row visible, section headers come before it
+	_, height := v.Size()
+	y := selected + 1
+	if selected >= len(active) {
+		y++
+	}
+	oy := 0
+	if y >= height {
+		oy = y - height + 1
+	}
+	v.SetOrigin(0, oy)
+}
+
+func (c *chat) setModerationKeybindings(g *gocui.Gui) error {
+	bindings := []struct {
+		view    string
+		key     interface{}
+		handler func(*gocui.Gui, *gocui.View) error
+	}{
+		{"moderation", gocui.KeyArrowUp, c.selectModRow(-1)},
+		{"moderation", gocui.KeyArrowDown, c.selectModRow(1)},
+		{"moderation", 'm', c.modQuickAction(c.quickMute)},
+		{"moderation", 'u', c.modQuickAction(c.quickUnmute)},
+		{"moderation", 'b', c.quickBan},
+		{"moderation", gocui.KeyEsc, c.closeModeration},
+	}
+	for _, b := range bindings {
+		if err := g.SetKeybinding(b.view, b.key, gocui.ModNone, b.handler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
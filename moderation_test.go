@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+func TestModLog(t *testing.T) {
+	c := newTestChat(t, testConfig(), &fakeSession{})
+	now := time.Now()
+	mod := dggchat.User{Nick: "mod"}
+
+	c.handleInput(`/ban bob "spamming links" 1d`)
+	c.renderBan(dggchat.Ban{Sender: mod, Target: dggchat.User{Nick: "Bob"}, Timestamp: now})
+	c.renderMute(dggchat.Mute{Sender: mod, Target: dggchat.User{Nick: "eve"}, Timestamp: now.Add(-2 * time.Hour)})
+	c.renderMute(dggchat.Mute{Sender: mod, Target: dggchat.User{Nick: "carol"}, Timestamp: now})
+	c.renderUnmute(dggchat.Mute{Sender: mod, Target: dggchat.User{Nick: "carol"}, Timestamp: now})
+
+	active := c.modLog.active(now)
+	var targets []string
+	for _, a := range active {
+		targets = append(targets, a.target)
+	}
+	if want := []string{"Bob", "eve"}; !reflect.DeepEqual(targets, want) {
+		t.Fatalf("active %q, want %q", targets, want)
+	}
+	if got, want := active[0].describe(), "mod banned Bob for 24h0m0s: spamming links"; got != want {
+		t.Errorf("ban described as %q, want %q", got, want)
+	}
+	if got := c.modLog.active(now.Add(25 * time.Hour)); len(got) != 1 || got[0].target != "eve" {
+		t.Errorf("expired ban still active: %v", got)
+	}
+	if len(c.modLog.actions) != 4 || c.modLog.actions[0].kind != "unmute" {
+		t.Errorf("log %v, want 4 actions newest first", c.modLog.actions)
+	}
+}
+
+func TestModQuickActions(t *testing.T) {
+	s := &fakeSession{}
+	c := newTestChat(t, testConfig(), s)
+
+	c.modQuickAction(c.quickMute)(nil, nil)
+	if countLines(c.guiwrapper, errNoModTarget.Error()) != 1 {
+		t.Errorf("quick action without a target, rendered %q", lines(c.guiwrapper))
+	}
+
+	c.modLog.setTarget("bob")
+	c.modQuickAction(c.quickMute)(nil, nil)
+	c.renderBan(dggchat.Ban{Sender: dggchat.User{Nick: "mod"}, Target: dggchat.User{Nick: "bob"}, Timestamp: time.Now()})
+	c.modQuickAction(c.quickUnmute)(nil, nil)
+	if want := []string{"MUTE bob 0s", "UNBAN bob"}; !reflect.DeepEqual(s.messages(), want) {
+		t.Errorf("sent %q, want %q", s.messages(), want)
+	}
+
+	c.quickBan(nil, nil)
+	if c.input.String() != "/ban bob " {
+		t.Errorf("ban not prepared in the input, got %q", c.input.String())
+	}
+}
+
+func TestMessageAt(t *testing.T) {
+	c := newTestChat(t, testConfig(), &fakeSession{})
+	gw := c.guiwrapper
+	gw.addMessage(guimessage{ts: time.Now(), tag: "   ", msg: strings.Repeat("x", 30), nick: "bob"})
+	gw.addMessage(guimessage{ts: time.Now(), tag: "   ", msg: "hi", nick: "eve"})
+	gw.marker = gw.messages[1]
+
+	// the first message wraps onto two lines at width 30, then the marker
+	for line, want := range []string{"bob", "bob", "", "eve", ""} {
+		nick := ""
+		if m := gw.messageAt(line, 30); m != nil {
+			nick = m.nick
+		}
+		if nick != want {
+			t.Errorf("line %d belongs to %q, want %q", line, nick, want)
+		}
+	}
+}
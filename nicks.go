@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+// readable 256 colors used for hashed nick colors
+var nickPalette = []int{
+	33, 37, 39, 43, 49, 69, 75, 79, 81, 105, 111, 114,
+	117, 141, 147, 150, 153, 172, 173, 176, 178, 180, 183, 186,
+	203, 207, 209, 211, 214, 216, 220, 222,
+}
+
+// flairs are checked in this order, the first one with a style wins
+var flairPriority = []string{
+	dggchat.FeatureAdministrator,
+	dggchat.FeatureModerator,
+	dggchat.FeatureBroadcaster,
+	dggchat.FeatureVIP,
+	dggchat.FeatureProtected,
+	dggchat.FeatureSubscriber,
+	dggchat.FeatureBot,
+	dggchat.FeatureBot2,
+}
+
+type flairStyle struct {
+	Style string `toml:"style"`
+	Badge string `toml:"badge"`
+
+	style color
+}
+
+var defaultFlairs = map[string]flairStyle{
+	dggchat.FeatureAdministrator: {Badge: "&"},
+	dggchat.FeatureModerator:     {Badge: "@"},
+	dggchat.FeatureBroadcaster:   {Badge: "%"},
+	dggchat.FeatureVIP:           {Badge: "!"},
+	dggchat.FeatureSubscriber:    {Badge: "+"},
+	dggchat.FeatureBot:           {Badge: "~"},
+	dggchat.FeatureBot2:          {Badge: "~"},
+}
+
+// compileFlairs merges the [flairs] config table with the default badges.
+func compileFlairs(configured map[string]flairStyle) (map[string]flairStyle, error) {
+	flairs := make(map[string]flairStyle, len(defaultFlairs))
+	for feature, f := range defaultFlairs {
+		flairs[feature] = f
+	}
+
+	for feature, f := range configured {
+		feature = strings.ToLower(feature)
+		if !isFlairFeature(feature) {
+			return nil, fmt.Errorf("unknown flair %q, valid flairs are: %s", feature, strings.Join(flairPriority, ", "))
+		}
+		if f.Badge == "" {
+			f.Badge = defaultFlairs[feature].Badge
+		}
+
+		var err error
+		f.style, err = parseStyle(f.Style)
+		if err != nil {
+			return nil, fmt.Errorf("flair %s: %v", feature, err)
+		}
+		flairs[feature] = f
+	}
+	return flairs, nil
+}
+
+func isFlairFeature(feature string) bool {
+	for _, f := range flairPriority {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// hashedNickColor always returns the same color for the same nick.
+func hashedNickColor(nick string) color {
+	h := fnv.New32a()
+	h.Write([]byte(strings.ToLower(nick)))
+	n := nickPalette[h.Sum32()%uint32(len(nickPalette))]
+	return color(fmt.Sprintf("\u001b[38;5;%dm", n))
+}
+
+// nickStyle picks the style of a nick: /tag colors win over flair styles,
+// then our own nick, hashed nick colors and finally fallback.
+func (c *chat) nickStyle(u dggchat.User, fallback color) color {
+	c.config.RLock()
+	tag, tagged := c.config.Tags[strings.ToLower(u.Nick)]
+	nickColors := c.config.NickColors
+	c.config.RUnlock()
+
+	if tagged {
+		return tagStyle(tag)
+	}
+
+	for _, feature := range flairPriority {
+		if f, ok := c.flairs[feature]; ok && f.style != none && u.HasFeature(feature) {
+			return f.style
+		}
+	}
+
+	if c.username != "" && strings.EqualFold(u.Nick, c.username) {
+		return c.theme.get("own_nick")
+	}
+
+	if nickColors {
+		return hashedNickColor(u.Nick) + attributes(fallback)
+	}
+	return fallback
+}
+
+// attributes strips the colors from style, keeping bold, underline and reverse.
+func attributes(style color) color {
+	var attrs color
+	for _, a := range []color{Bold, Underline, Reversed} {
+		if strings.Contains(string(style), string(a)) {
+			attrs += a
+		}
+	}
+	return attrs
+}
+
+// badges returns the badges of all flairs of u, e.g. "@+".
+func (c *chat) badges(u dggchat.User) string {
+	if !c.config.FlairBadges {
+		return ""
+	}
+
+	var b strings.Builder
+	for _, feature := range flairPriority {
+		if f, ok := c.flairs[feature]; ok && u.HasFeature(feature) && !strings.Contains(b.String(), f.Badge) {
+			b.WriteString(f.Badge)
+		}
+	}
+	return b.String()
+}
+
+// formatNick renders the badges and the styled nick of u.
+func (c *chat) formatNick(u dggchat.User, fallback color) string {
+	return fmt.Sprintf("%s%s%s%s", c.badges(u), c.nickStyle(u, fallback), u.Nick, reset)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+type notificationConfig struct {
+	Backends     []string `toml:"backends"` // bell, osc9, osc777 and command
+	Command      []string `toml:"command"`  // {title} and {body} are replaced
+	Mentions     bool     `toml:"mentions"`
+	Whispers     bool     `toml:"whispers"`
+	Stalks       bool     `toml:"stalks"`
+	RateLimit    int      `toml:"rate_limit"` // minimum seconds between notifications
+	DoNotDisturb bool     `toml:"do_not_disturb"`
+}
+
+type notificationBackend interface {
+	notify(title, body string) error
+}
+
+// bellBackend rings the terminal bell.
+type bellBackend struct {
+	terminal *terminalWriter
+}
+
+func (b bellBackend) notify(title, body string) error {
+	b.terminal.write("\a")
+	return nil
+}
+
+// oscBackend sends a desktop notification through the terminal, OSC 9 is
+// understood by iTerm2, kitty and others, OSC 777 by urxvt and vte based terminals.
+type oscBackend struct {
+	terminal *terminalWriter
+	code     int
+}
+
+func (o oscBackend) notify(title, body string) error {
+	if o.code == 777 {
+		o.terminal.write(fmt.Sprintf("\u001b]777;notify;%s;%s\a", title, body))
+	} else {
+		o.terminal.write(fmt.Sprintf("\u001b]9;%s: %s\a", title, body))
+	}
+	return nil
+}
+
+// commandBackend runs a command like notify-send, it does not wait for the command to exit.
+type commandBackend struct {
+	args []string
+}
+
+func (cb commandBackend) notify(title, body string) error {
+	r := strings.NewReplacer("{title}", title, "{body}", body)
+	args := make([]string, len(cb.args))
+	for i, a := range cb.args {
+		args[i] = r.Replace(a)
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+type notifier struct {
+	backends   []notificationBackend
+	interval   time.Duration
+	dnd        bool
+	last       time.Time
+	suppressed int
+	sync.Mutex
+}
+
+// newNotifier creates the configured backends, the bell and OSC backends write to terminal.
+func newNotifier(cfg notificationConfig, terminal *terminalWriter) (*notifier, error) {
+	n := &notifier{
+		interval: time.Duration(cfg.RateLimit) * time.Second,
+		dnd:      cfg.DoNotDisturb,
+	}
+
+	for _, b := range cfg.Backends {
+		switch strings.ToLower(b) {
+		case "bell":
+			n.backends = append(n.backends, bellBackend{terminal})
+		case "osc9":
+			n.backends = append(n.backends, oscBackend{terminal, 9})
+		case "osc777":
+			n.backends = append(n.backends, oscBackend{terminal, 777})
+		case "command":
+			if len(cfg.Command) == 0 {
+				return nil, errors.New("notification backend command needs a command")
+			}
+			n.backends = append(n.backends, commandBackend{cfg.Command})
+		default:
+			return nil, fmt.Errorf("unknown notification backend %q, must be one of bell, osc9, osc777 or command", b)
+		}
+	}
+	return n, nil
+}
+
+// removeTerminalBackends keeps only backends that don't write to the terminal.
+func (n *notifier) removeTerminalBackends() {
+	n.Lock()
+	defer n.Unlock()
+
+	var backends []notificationBackend
+	for _, b := range n.backends {
+		if _, ok := b.(commandBackend); ok {
+			backends = append(backends, b)
+		}
+	}
+	n.backends = backends
+}
+
+func (n *notifier) setDND(dnd bool) {
+	n.Lock()
+	n.dnd = dnd
+	n.Unlock()
+}
+
+// allow applies do not disturb and the rate limit. Events of the chat history
+// never get here, only live events notify.
+func (n *notifier) allow() (bool, int) {
+	n.Lock()
+	defer n.Unlock()
+
+	if n.dnd || len(n.backends) == 0 {
+		return false, 0
+	}
+	if time.Since(n.last) < n.interval {
+		n.suppressed++
+		return false, 0
+	}
+
+	suppressed := n.suppressed
+	n.last = time.Now()
+	n.suppressed = 0
+	return true, suppressed
+}
+
+// notify sends a notification to all configured backends.
+func (c *chat) notify(title string, body string) {
+	ok, suppressed := c.notifier.allow()
+	if !ok {
+		return
+	}
+	if suppressed > 0 {
+		body = fmt.Sprintf("%s (+%d more)", body, suppressed)
+	}
+
+	title, body = stripControl(title), stripControl(body)
+	for _, b := range c.notifier.backends {
+		if err := b.notify(title, body); err != nil {
+			c.renderDebug(fmt.Sprintf("notification: %v", err))
+		}
+	}
+}
+
+// stripControl removes control characters, C0 and C1 like ST (U+009C) could
+// end the escape sequence of the OSC backends.
+func stripControl(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
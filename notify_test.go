@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+type recordingBackend struct {
+	notifications []string
+}
+
+func (r *recordingBackend) notify(title, body string) error {
+	r.notifications = append(r.notifications, title+": "+body)
+	return nil
+}
+
+func TestNotifyLiveOnly(t *testing.T) {
+	cfg := testConfig()
+	cfg.Notifications.Mentions = true
+	s := &fakeSession{}
+	c := newTestChat(t, cfg, s)
+	rec := &recordingBackend{}
+	c.notifier.backends = []notificationBackend{rec}
+	c.history = newHistoryLoader("")
+
+	// server timestamps are truncated to seconds and may lag behind our clock
+	past := time.Now().Add(-time.Minute)
+	s.onMessage(dggchat.Message{Sender: dggchat.User{Nick: "bob"}, Timestamp: past, Message: "hi tester"}, nil)
+
+	// backfilled after a reconnect, newer than our start but not live
+	line := fmt.Sprintf(`MSG {"nick":"bob","timestamp":%d,"data":"old tester"}`, time.Now().Add(time.Minute).Unix()*1000)
+	if err := c.renderHistoryEvent(line, true); err != nil {
+		t.Fatal(err)
+	}
+	if countLines(c.guiwrapper, "old tester") != 1 {
+		t.Fatalf("backfilled message not rendered: %q", lines(c.guiwrapper))
+	}
+
+	if want := []string{"bob: hi tester"}; fmt.Sprint(rec.notifications) != fmt.Sprint(want) {
+		t.Errorf("notified %q, want %q", rec.notifications, want)
+	}
+}
+
+func TestStripControl(t *testing.T) {
+	if got := stripControl("a\u0007b\u001bc\u009cd\u0085e\u007f"); got != "abcde" {
+		t.Errorf("stripControl left %q", got)
+	}
+}
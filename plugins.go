@@ -0,0 +1,494 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Plugins are external executables speaking JSON-RPC 2.0, one message per
+// line on stdin and stdout. tsgg sends them "event" notifications with the
+// same fields as the JSON chat log and "command" notifications when one of
+// their commands is used. Plugins call the methods in pluginMethods.
+type pluginConfig struct {
+	Name    string   `toml:"name"`
+	Command []string `toml:"command"`
+}
+
+const (
+	pluginQueueSize = 256
+	// plugins get this long to exit after their stdin was closed
+	pluginStopTimeout = 2 * time.Second
+)
+
+// JSON-RPC error codes
+const (
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+)
+
+// rpcRequest is a request or a notification, plugins send both, tsgg only notifications.
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// rpcResponse answers a request of a plugin, exactly one of Result and Error
+// is set, a nil result is sent as null.
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type pluginCommand struct {
+	Name  string   `json:"name"`
+	Usage string   `json:"usage,omitempty"`
+	Args  []string `json:"args,omitempty"`
+}
+
+type pluginText struct {
+	Nick string `json:"nick,omitempty"`
+	Data string `json:"data"`
+}
+
+type plugin struct {
+	name     string
+	cmd      *exec.Cmd
+	queue    chan []byte   // lines waiting to be written to stdin
+	quit     chan struct{} // closed to close stdin, asking the plugin to exit
+	done     chan struct{} // closed once the process exited
+	commands map[string]pluginCommand
+}
+
+// pluginHost runs the configured plugins. A plugin that crashes or stops
+// reading is dropped and reported in the debug view, tsgg keeps running.
+type pluginHost struct {
+	chat       *chat
+	configs    []pluginConfig
+	plugins    []*plugin
+	highlights []highlightRule // added by plugins, not saved to the config
+	sync.RWMutex
+}
+
+func newPluginHost(c *chat, configs []pluginConfig) (*pluginHost, error) {
+	names := make(map[string]bool)
+	for _, pc := range configs {
+		if pc.Name == "" || len(pc.Command) == 0 {
+			return nil, errors.New("plugins need a name and a command")
+		}
+		if names[pc.Name] {
+			return nil, fmt.Errorf("duplicate plugin %s", pc.Name)
+		}
+		names[pc.Name] = true
+	}
+	return &pluginHost{chat: c, configs: configs}, nil
+}
+
+// start launches all plugins, plugins that fail to start are reported and skipped.
+func (h *pluginHost) start() {
+	for _, pc := range h.configs {
+		if err := h.launch(pc); err != nil {
+			h.chat.renderError(fmt.Sprintf("plugin %s: %v", pc.Name, err))
+		}
+	}
+}
+
+func (h *pluginHost) launch(pc pluginConfig) error {
+	p := &plugin{
+		name:     pc.Name,
+		cmd:      exec.Command(pc.Command[0], pc.Command[1:]...),
+		queue:    make(chan []byte, pluginQueueSize),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+		commands: make(map[string]pluginCommand),
+	}
+
+	stdin, err := p.cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := p.cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := p.cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := p.cmd.Start(); err != nil {
+		return err
+	}
+
+	h.Lock()
+	h.plugins = append(h.plugins, p)
+	h.Unlock()
+
+	stderrDone := make(chan struct{})
+	go h.writeLoop(p, stdin)
+	go func() {
+		h.logStderr(p, stderr)
+		close(stderrDone)
+	}()
+	go func() {
+		h.readLoop(p, stdout)
+		// Wait closes the pipes, finish reading them first
+		<-stderrDone
+		err := p.cmd.Wait()
+		h.remove(p)
+		close(p.done)
+		if err == nil {
+			err = errors.New("exited")
+		}
+		h.chat.renderDebug(fmt.Sprintf("plugin %s stopped: %v", p.name, err))
+	}()
+	return nil
+}
+
+func (h *pluginHost) writeLoop(p *plugin, stdin io.WriteCloser) {
+	defer stdin.Close()
+	for {
+		select {
+		case line := <-p.queue:
+			if _, err := stdin.Write(line); err != nil {
+				h.chat.renderDebug(fmt.Sprintf("plugin %s: %v", p.name, err))
+				return
+			}
+		case <-p.quit:
+			// write what is queued, closing stdin then asks the plugin to exit
+			for {
+				select {
+				case line := <-p.queue:
+					if _, err := stdin.Write(line); err != nil {
+						return
+					}
+				default:
+					return
+				}
+			}
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func (h *pluginHost) logStderr(p *plugin, stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		h.chat.renderDebug(fmt.Sprintf("plugin %s: %s", p.name, scanner.Text()))
+	}
+}
+
+func (h *pluginHost) readLoop(p *plugin, stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var m rpcRequest
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			h.chat.renderDebug(fmt.Sprintf("plugin %s: malformed message: %v", p.name, err))
+			h.write(p, "error response", newResponse(json.RawMessage("null"), nil, &rpcError{rpcInvalidRequest, err.Error()}))
+			continue
+		}
+		if m.Method == "" {
+			// responses to our notifications are not expected, ignore them
+			continue
+		}
+
+		result, rerr := h.call(p, m.Method, m.Params)
+		if len(m.ID) == 0 {
+			if rerr != nil {
+				h.chat.renderDebug(fmt.Sprintf("plugin %s: %s: %s", p.name, m.Method, rerr.Message))
+			}
+			continue
+		}
+		h.write(p, "response to "+m.Method, newResponse(m.ID, result, rerr))
+	}
+	if err := scanner.Err(); err != nil {
+		h.chat.renderDebug(fmt.Sprintf("plugin %s: %v", p.name, err))
+	}
+}
+
+func newResponse(id json.RawMessage, result interface{}, rerr *rpcError) rpcResponse {
+	if rerr != nil {
+		return rpcResponse{JSONRPC: "2.0", ID: id, Error: rerr}
+	}
+	b, err := json.Marshal(result)
+	if err != nil {
+		return rpcResponse{JSONRPC: "2.0", ID: id, Error: &rpcError{rpcInternalError, err.Error()}}
+	}
+	return rpcResponse{JSONRPC: "2.0", ID: id, Result: b}
+}
+
+// send queues a notification for p.
+func (h *pluginHost) send(p *plugin, m rpcRequest) {
+	m.JSONRPC = "2.0"
+	h.write(p, m.Method, m)
+}
+
+// write queues v without blocking, messages to plugins that don't keep up are
+// dropped, what names v in the debug view.
+func (h *pluginHost) write(p *plugin, what string, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		h.chat.renderDebug(fmt.Sprintf("plugin %s: %v", p.name, err))
+		return
+	}
+
+	select {
+	case p.queue <- append(b, '\n'):
+	case <-p.done:
+	default:
+		h.chat.renderDebug(fmt.Sprintf("plugin %s is not reading, dropped %s", p.name, what))
+	}
+}
+
+func (h *pluginHost) remove(p *plugin) {
+	h.Lock()
+	defer h.Unlock()
+	for i, other := range h.plugins {
+		if other == p {
+			h.plugins = append(h.plugins[:i], h.plugins[i+1:]...)
+			return
+		}
+	}
+}
+
+// stop closes the stdin of all plugins, plugins still running after
+// pluginStopTimeout are killed. It returns once all of them exited.
+func (h *pluginHost) stop() {
+	// exiting plugins remove themselves, don't hold the lock while waiting
+	h.RLock()
+	plugins := append([]*plugin(nil), h.plugins...)
+	h.RUnlock()
+
+	for _, p := range plugins {
+		close(p.quit)
+	}
+	timer := time.NewTimer(pluginStopTimeout)
+	defer timer.Stop()
+	expired := false
+	for _, p := range plugins {
+		if !expired {
+			select {
+			case <-p.done:
+				continue
+			case <-timer.C:
+				expired = true
+			}
+		}
+		p.cmd.Process.Kill()
+		<-p.done
+	}
+}
+
+// event forwards a chat event to all plugins.
+func (h *pluginHost) event(e logEntry) {
+	params, _ := json.Marshal(e)
+
+	h.RLock()
+	defer h.RUnlock()
+	for _, p := range h.plugins {
+		h.send(p, rpcRequest{Method: "event", Params: params})
+	}
+}
+
+// command returns the plugin that registered the slash command name.
+func (h *pluginHost) command(name string) (*plugin, bool) {
+	h.RLock()
+	defer h.RUnlock()
+	for _, p := range h.plugins {
+		if _, ok := p.commands[name]; ok {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// commandNames lists all commands registered by plugins.
+func (h *pluginHost) commandNames() []string {
+	h.RLock()
+	defer h.RUnlock()
+	var names []string
+	for _, p := range h.plugins {
+		for name := range p.commands {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (h *pluginHost) runCommand(p *plugin, tokens []string) {
+	params, _ := json.Marshal(pluginCommand{Name: tokens[0], Args: tokens[1:]})
+	h.send(p, rpcRequest{Method: "command", Params: params})
+}
+
+func (h *pluginHost) highlightRules() []highlightRule {
+	h.RLock()
+	defer h.RUnlock()
+	return append([]highlightRule{}, h.highlights...)
+}
+
+var pluginMethods = map[string]func(h *pluginHost, p *plugin, params json.RawMessage) (interface{}, error){
+	"register_command": (*pluginHost).registerCommand,
+	"send_message":     (*pluginHost).sendMessage,
+	"send_whisper":     (*pluginHost).sendWhisper,
+	"render":           (*pluginHost).render,
+	"add_highlight":    (*pluginHost).addHighlight,
+}
+
+func (h *pluginHost) call(p *plugin, method string, params json.RawMessage) (interface{}, *rpcError) {
+	f, ok := pluginMethods[method]
+	if !ok {
+		return nil, &rpcError{rpcMethodNotFound, fmt.Sprintf("unknown method %s", method)}
+	}
+
+	var result interface{}
+	err := func() (err error) {
+		// a bad request must not take down tsgg
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("internal error: %v", r)
+			}
+		}()
+		result, err = f(h, p, params)
+		return err
+	}()
+
+	var perr paramsError
+	if errors.As(err, &perr) {
+		return nil, &rpcError{rpcInvalidParams, err.Error()}
+	}
+	if err != nil {
+		return nil, &rpcError{rpcInternalError, err.Error()}
+	}
+	return result, nil
+}
+
+type paramsError struct {
+	err error
+}
+
+func (e paramsError) Error() string {
+	return "invalid params: " + e.err.Error()
+}
+
+func decodeParams(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return paramsError{err}
+	}
+	return nil
+}
+
+func (h *pluginHost) registerCommand(p *plugin, params json.RawMessage) (interface{}, error) {
+	var cmd pluginCommand
+	if err := decodeParams(params, &cmd); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(cmd.Name, "/") || strings.ContainsAny(cmd.Name, " \t") {
+		return nil, paramsError{fmt.Errorf("invalid command name %q", cmd.Name)}
+	}
+	if _, ok := h.chat.commands[cmd.Name]; ok {
+		return nil, fmt.Errorf("%s is a builtin command", cmd.Name)
+	}
+	if other, ok := h.command(cmd.Name); ok && other != p {
+		return nil, fmt.Errorf("%s is already registered by plugin %s", cmd.Name, other.name)
+	}
+
+	h.Lock()
+	p.commands[cmd.Name] = cmd
+	h.Unlock()
+	return true, nil
+}
+
+func (h *pluginHost) sendMessage(p *plugin, params json.RawMessage) (interface{}, error) {
+	var t pluginText
+	if err := decodeParams(params, &t); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(t.Data) == "" {
+		return nil, paramsError{errors.New("empty message")}
+	}
+	return true, h.chat.Session.SendMessage(t.Data)
+}
+
+func (h *pluginHost) sendWhisper(p *plugin, params json.RawMessage) (interface{}, error) {
+	var t pluginText
+	if err := decodeParams(params, &t); err != nil {
+		return nil, err
+	}
+	if t.Nick == "" || strings.TrimSpace(t.Data) == "" {
+		return nil, paramsError{errors.New("nick and data are required")}
+	}
+	return true, sendWhisper(h.chat, []string{"/w", t.Nick, t.Data})
+}
+
+func (h *pluginHost) render(p *plugin, params json.RawMessage) (interface{}, error) {
+	var t pluginText
+	if err := decodeParams(params, &t); err != nil {
+		return nil, err
+	}
+	h.chat.renderCommand(fmt.Sprintf("[%s] %s", p.name, t.Data))
+	return true, nil
+}
+
+func (h *pluginHost) addHighlight(p *plugin, params json.RawMessage) (interface{}, error) {
+	var rule highlightRule
+	if err := decodeParams(params, &rule); err != nil {
+		return nil, err
+	}
+	if err := rule.compile(); err != nil {
+		return nil, paramsError{err}
+	}
+
+	h.Lock()
+	h.highlights = append(h.highlights, rule)
+	h.Unlock()
+	return true, h.chat.compileHighlights()
+}
+
+func listPlugins(c *chat, tokens []string) error {
+	c.plugins.RLock()
+	defer c.plugins.RUnlock()
+
+	if len(c.plugins.configs) == 0 {
+		c.renderCommand("No plugins configured")
+		return nil
+	}
+
+	running := make(map[string]*plugin)
+	for _, p := range c.plugins.plugins {
+		running[p.name] = p
+	}
+	for _, pc := range c.plugins.configs {
+		p, ok := running[pc.Name]
+		if !ok {
+			c.renderCommand(fmt.Sprintf("%s: stopped", pc.Name))
+			continue
+		}
+		var names []string
+		for name := range p.commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		c.renderCommand(fmt.Sprintf("%s: running, commands: %s", pc.Name, strings.Join(names, ", ")))
+	}
+	return nil
+}
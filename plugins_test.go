@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+// TestPluginProcess is not a real test, it is the plugin started by the
+// other plugin tests.
+func TestPluginProcess(t *testing.T) {
+	if os.Getenv("TSGG_TEST_PLUGIN") != "1" {
+		t.Skip("only runs as plugin")
+	}
+
+	call := func(method string, params interface{}) {
+		b, _ := json.Marshal(params)
+		fmt.Printf(`{"jsonrpc":"2.0","id":1,"method":%q,"params":%s}`+"\n", method, b)
+	}
+	call("register_command", map[string]string{"name": "/echo", "usage": "text"})
+	call("add_highlight", map[string]interface{}{"pattern": "plugins?", "type": "regex"})
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var m struct {
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil || m.Method == "" {
+			continue
+		}
+
+		switch m.Method {
+		case "command":
+			var cmd pluginCommand
+			json.Unmarshal(m.Params, &cmd)
+			call("render", map[string]string{"data": strings.Join(cmd.Args, " ")})
+		case "event":
+			var e logEntry
+			json.Unmarshal(m.Params, &e)
+			switch e.Data {
+			case "ping":
+				call("send_message", map[string]string{"data": "pong"})
+			case "whisper":
+				call("send_whisper", map[string]string{"nick": e.Nick, "data": "psst"})
+			case "crash":
+				fmt.Fprintln(os.Stderr, "crashing")
+				os.Exit(3)
+			}
+		}
+	}
+	os.Exit(0)
+}
+
+func startTestPlugin(t *testing.T) (*chat, *fakeSession) {
+	t.Helper()
+	os.Setenv("TSGG_TEST_PLUGIN", "1")
+	defer os.Unsetenv("TSGG_TEST_PLUGIN")
+
+	cfg := testConfig()
+	cfg.Plugins = []pluginConfig{{Name: "test", Command: []string{os.Args[0], "-test.run=^TestPluginProcess$"}}}
+	s := &fakeSession{}
+	c := newTestChat(t, cfg, s)
+	c.plugins.start()
+	t.Cleanup(c.plugins.stop)
+
+	waitFor(t, "plugin command", func() bool {
+		_, ok := c.plugins.command("/echo")
+		return ok
+	})
+	return c, s
+}
+
+func TestPlugin(t *testing.T) {
+	c, s := startTestPlugin(t)
+
+	c.handleInput("/echo hello plugin")
+	waitFor(t, "rendered line", func() bool { return countLines(c.guiwrapper, "[test] hello plugin") == 1 })
+
+	s.onMessage(dggchat.Message{Sender: dggchat.User{Nick: "bob"}, Timestamp: time.Now(), Message: "ping"}, nil)
+	s.onMessage(dggchat.Message{Sender: dggchat.User{Nick: "bob"}, Timestamp: time.Now(), Message: "whisper"}, nil)
+	waitFor(t, "plugin messages", func() bool { return len(s.messages()) == 2 })
+	if want := []string{"MSG pong", "PRIVMSG bob psst"}; !reflect.DeepEqual(s.messages(), want) {
+		t.Errorf("sent %q, want %q", s.messages(), want)
+	}
+
+	if rule := c.highlightFor(dggchat.Message{Message: "i like plugins"}); rule == nil || rule.Pattern != "plugins?" {
+		t.Errorf("plugin highlight not applied, got %v", rule)
+	}
+}
+
+func TestPluginCrash(t *testing.T) {
+	c, s := startTestPlugin(t)
+
+	s.onMessage(dggchat.Message{Sender: dggchat.User{Nick: "bob"}, Timestamp: time.Now(), Message: "crash"}, nil)
+	waitFor(t, "plugin exit", func() bool {
+		_, ok := c.plugins.command("/echo")
+		return !ok
+	})
+
+	// events and commands of crashed plugins are dropped
+	s.onMessage(dggchat.Message{Sender: dggchat.User{Nick: "bob"}, Timestamp: time.Now(), Message: "ping"}, nil)
+	c.handleInput("/echo hello")
+	if n := countLines(c.guiwrapper, "unknown command: /echo"); n != 1 {
+		t.Errorf("plugin command still available after crash")
+	}
+}
+
+func TestPluginStop(t *testing.T) {
+	c, _ := startTestPlugin(t)
+	c.plugins.RLock()
+	p := c.plugins.plugins[0]
+	c.plugins.RUnlock()
+
+	c.plugins.stop()
+	if !p.cmd.ProcessState.Success() {
+		t.Errorf("plugin did not exit on its own: %v", p.cmd.ProcessState)
+	}
+	if _, ok := c.plugins.command("/echo"); ok {
+		t.Errorf("stopped plugin still registered")
+	}
+}
+
+func TestRPCResponse(t *testing.T) {
+	tests := []struct {
+		result interface{}
+		err    *rpcError
+		want   string
+	}{
+		{true, nil, `{"jsonrpc":"2.0","id":1,"result":true}`},
+		{nil, nil, `{"jsonrpc":"2.0","id":1,"result":null}`},
+		{false, nil, `{"jsonrpc":"2.0","id":1,"result":false}`},
+		{nil, &rpcError{rpcInvalidParams, "bad"}, `{"jsonrpc":"2.0","id":1,"error":{"code":-32602,"message":"bad"}}`},
+	}
+	for _, tt := range tests {
+		b, err := json.Marshal(newResponse(json.RawMessage("1"), tt.result, tt.err))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tt.want {
+			t.Errorf("response %s, want %s", b, tt.want)
+		}
+	}
+}
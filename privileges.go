@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+// features of users allowed to run privileged commands
+var privilegedFeatures = []string{dggchat.FeatureAdministrator, dggchat.FeatureModerator}
+
+// ownFeatures looks up our user in the users list, ok is false until we show
+// up in it, e.g. before connecting or without a configured username.
+func (c *chat) ownFeatures() (features []string, ok bool) {
+	if c.username == "" {
+		return nil, false
+	}
+	for _, u := range c.Session.GetUsers() {
+		if strings.EqualFold(u.Nick, c.username) {
+			return u.Features, true
+		}
+	}
+	return nil, false
+}
+
+// privileged reports whether our user is known to be a moderator.
+func (c *chat) privileged() bool {
+	features, _ := c.ownFeatures()
+	for _, f := range privilegedFeatures {
+		if contains(features, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPrivileged fails for users known not to be moderators, as long as our
+// features are unknown the server decides.
+func (c *chat) checkPrivileged(name string) error {
+	if _, ok := c.ownFeatures(); !ok || c.privileged() {
+		return nil
+	}
+	return fmt.Errorf("%s is only available to moderators", name)
+}
+
+// visible reports whether a command is shown in the help and completed,
+// privileged commands only once we are known to be a moderator.
+func (c *chat) visible(cmd command) bool {
+	return !cmd.privileged || c.privileged()
+}
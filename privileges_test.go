@@ -0,0 +1,43 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+func TestPrivilegedCommands(t *testing.T) {
+	s := &fakeSession{}
+	c := newTestChat(t, testConfig(), s)
+
+	// until we show up in the users list they are hidden, the server decides
+	if strings.Contains(c.helpText(), "/ban") {
+		t.Errorf("privileged commands shown before our features are known:\n%s", c.helpText())
+	}
+
+	s.users = []dggchat.User{{Nick: "Tester", Features: []string{"subscriber"}}}
+	if strings.Contains(c.helpText(), "/ban") {
+		t.Errorf("privileged commands in the help of a non-moderator:\n%s", c.helpText())
+	}
+	if got := c.candidates(nil, "/unb"); len(got) != 0 {
+		t.Errorf("completed %q for a non-moderator", got)
+	}
+	c.handleInput("/ban bob spam")
+	if countLines(c.guiwrapper, "/ban is only available to moderators") != 1 {
+		t.Errorf("no local error, rendered %q", lines(c.guiwrapper))
+	}
+
+	s.users = []dggchat.User{{Nick: "tester", Features: []string{"moderator"}}}
+	if !strings.Contains(c.helpText(), "* /ban") {
+		t.Errorf("privileged commands missing from the help of a moderator:\n%s", c.helpText())
+	}
+	if got, want := c.candidates(nil, "/unb"), []string{"/unban"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("completed %q for a moderator, want %q", got, want)
+	}
+	c.handleInput("/ban bob spam")
+	if want := []string{`BAN bob "spam" 0s ip=false`}; !reflect.DeepEqual(s.messages(), want) {
+		t.Errorf("sent %q, want %q", s.messages(), want)
+	}
+}
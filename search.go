@@ -0,0 +1,298 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/awesome-gocui/gocui"
+	"github.com/mattn/go-runewidth"
+)
+
+// search holds the state of the scrollback search prompt. Matches are kept
+// as pointers, because the buffer drops its oldest lines once maxlines is reached.
+type search struct {
+	buffer  *guiwrapper
+	query   string
+	pattern *regexp.Regexp
+	matches []*guimessage // oldest first
+	index   int
+}
+
+var ansiEscape = regexp.MustCompile("\u001b\\[[0-9;]*m")
+
+func stripANSI(s string) string {
+	return ansiEscape.ReplaceAllString(s, "")
+}
+
+// compileSearch treats queries enclosed in slashes as regular expressions,
+// everything else as a case-insensitive substring.
+func compileSearch(query string) (*regexp.Regexp, error) {
+	if len(query) > 2 && strings.HasPrefix(query, "/") && strings.HasSuffix(query, "/") {
+		return regexp.Compile("(?i)" + query[1:len(query)-1])
+	}
+	return regexp.Compile("(?i)" + regexp.QuoteMeta(query))
+}
+
+// escapeAt returns the color escape sequence s starts with, if any.
+func escapeAt(s string) string {
+	if !strings.HasPrefix(s, "\u001b[") {
+		return ""
+	}
+	if loc := ansiEscape.FindStringIndex(s); loc != nil && loc[0] == 0 {
+		return s[:loc[1]]
+	}
+	return ""
+}
+
+// bodyOffset is where the searchable body starts in the visible text of
+// m.msg, after the badges and the nick of chat messages.
+func bodyOffset(m *guimessage) int {
+	if m.nick == "" {
+		return 0
+	}
+	if i := strings.Index(stripANSI(m.msg), m.nick+": "); i > -1 {
+		return i + len(m.nick) + 2
+	}
+	return 0
+}
+
+// body returns the visible text of a message that is searched.
+func body(m *guimessage) string {
+	return stripANSI(m.msg)[bodyOffset(m):]
+}
+
+// highlightMatches styles the matches of re in the visible text of a
+// formatted line from the visible offset from on. The colors of the line stay
+// in place around the matches.
+func highlightMatches(text string, re *regexp.Regexp, style color, from int) string {
+	var matches [][]int
+	for _, m := range re.FindAllStringIndex(stripANSI(text)[from:], -1) {
+		if m[0] < m[1] {
+			matches = append(matches, []int{m[0] + from, m[1] + from})
+		}
+	}
+	if len(matches) == 0 {
+		return text
+	}
+
+	var b strings.Builder
+	active := "" // escape sequences in effect since the last reset
+	pos := 0     // position in the visible text
+	inMatch := false
+	for i := 0; ; {
+		if inMatch && pos == matches[0][1] {
+			b.WriteString(string(reset) + active)
+			inMatch = false
+			matches = matches[1:]
+		}
+		if seq := escapeAt(text[i:]); seq != "" {
+			if seq == string(reset) {
+				active = ""
+			} else {
+				active += seq
+			}
+			b.WriteString(seq)
+			// colors inside a match must not replace its style
+			if inMatch {
+				b.WriteString(string(style))
+			}
+			i += len(seq)
+			continue
+		}
+		if !inMatch && len(matches) > 0 && pos == matches[0][0] {
+			b.WriteString(string(style))
+			inMatch = true
+		}
+		if i == len(text) {
+			break
+		}
+		b.WriteByte(text[i])
+		i++
+		pos++
+	}
+	return b.String()
+}
+
+// wrappedLines returns how many lines s occupies in a wrapping view of the given width.
+func wrappedLines(s string, width int) int {
+	if width <= 0 {
+		return 1
+	}
+
+	lines, n := 1, 0
+	for _, r := range s {
+		rw := runewidth.RuneWidth(r)
+		n += rw
+		if n > width {
+			n = rw
+			lines++
+		}
+	}
+	return lines
+}
+
+func (c *chat) openSearch(g *gocui.Gui, v *gocui.View) error {
+	searchView, err := g.View("search")
+	if err != nil {
+		return err
+	}
+
+	messageView, err := g.View("messages")
+	if err != nil {
+		return err
+	}
+	// freeze the messages view, see redraw()
+	messageView.Autoscroll = false
+
+	c.search = &search{buffer: c.buffers.active()}
+	searchView.Visible = true
+	searchView.Title = " search (/regex/ for regex, up/down to navigate, esc to close): "
+	searchView.Clear()
+	searchView.SetCursor(0, 0)
+	searchView.SetOrigin(0, 0)
+	_, err = g.SetCurrentView("search")
+	return err
+}
+
+func (c *chat) closeSearch(g *gocui.Gui, v *gocui.View) error {
+	if c.search == nil {
+		return nil
+	}
+	gw := c.search.buffer
+	c.search = nil
+
+	searchView, err := g.View("search")
+	if err != nil {
+		return err
+	}
+	searchView.Visible = false
+
+	messageView, err := g.View("messages")
+	if err != nil {
+		return err
+	}
+	messageView.Autoscroll = true
+	gw.redraw()
+
+	_, err = g.SetCurrentView("input")
+	return err
+}
+
+// runSearch searches the buffer for the query typed into the search view.
+// Searching the same query again jumps to the next older match.
+func (c *chat) runSearch(g *gocui.Gui, v *gocui.View) error {
+	if c.search == nil {
+		return nil
+	}
+
+	query := strings.TrimSpace(v.Buffer())
+	if query == "" {
+		return nil
+	}
+
+	if query == c.search.query && len(c.search.matches) > 0 {
+		return c.searchOlder(g, v)
+	}
+
+	pattern, err := compileSearch(query)
+	if err != nil {
+		v.Title = fmt.Sprintf(" search: invalid regex: %v ", err)
+		return nil
+	}
+
+	s := c.search
+	s.query = query
+	s.pattern = pattern
+	s.matches = nil
+
+	s.buffer.RLock()
+	for _, m := range s.buffer.messages {
+		if pattern.MatchString(body(m)) {
+			s.matches = append(s.matches, m)
+		}
+	}
+	s.buffer.RUnlock()
+
+	if len(s.matches) == 0 {
+		v.Title = fmt.Sprintf(" search: no matches for %s ", query)
+		return nil
+	}
+
+	// start at the most recent match
+	s.index = len(s.matches) - 1
+	c.drawSearch(g, v)
+	return nil
+}
+
+func (c *chat) searchOlder(g *gocui.Gui, v *gocui.View) error {
+	if c.search == nil || len(c.search.matches) == 0 {
+		return nil
+	}
+	if c.search.index > 0 {
+		c.search.index--
+	}
+	c.drawSearch(g, v)
+	return nil
+}
+
+func (c *chat) searchNewer(g *gocui.Gui, v *gocui.View) error {
+	if c.search == nil || len(c.search.matches) == 0 {
+		return nil
+	}
+	if c.search.index < len(c.search.matches)-1 {
+		c.search.index++
+	}
+	c.drawSearch(g, v)
+	return nil
+}
+
+// drawSearch renders the searched buffer with all matches highlighted and
+// scrolls the messages view so the current match is centered.
+func (c *chat) drawSearch(g *gocui.Gui, searchView *gocui.View) {
+	s := c.search
+	messageView, err := g.View("messages")
+	if err != nil {
+		return
+	}
+	maxX, maxY := messageView.Size()
+	current := s.matches[s.index]
+
+	isMatch := make(map[*guimessage]bool, len(s.matches))
+	for _, m := range s.matches {
+		isMatch[m] = true
+	}
+
+	gw := s.buffer
+	gw.RLock()
+	var buf strings.Builder
+	line, target := 0, 0
+	for _, m := range gw.messages {
+		text := gw.formatMessage(m)
+		if isMatch[m] {
+			style := c.theme.get("search_match")
+			if m == current {
+				style = c.theme.get("search_current")
+				target = line
+			}
+			// the timestamp, the tag and the nick are not searched
+			from := len(stripANSI(text)) - len(stripANSI(m.msg)) + bodyOffset(m)
+			text = highlightMatches(text, s.pattern, style, from)
+		}
+		line += wrappedLines(stripANSI(text), maxX)
+		buf.WriteString(text + "\n")
+	}
+	gw.RUnlock()
+
+	messageView.Autoscroll = false
+	messageView.Clear()
+	fmt.Fprint(messageView, buf.String())
+
+	oy := target - maxY/2
+	if oy < 0 {
+		oy = 0
+	}
+	messageView.SetOrigin(0, oy)
+
+	searchView.Title = fmt.Sprintf(" search: match %d/%d (up/down to navigate, esc to close) ", s.index+1, len(s.matches))
+}
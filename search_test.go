@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+func TestHighlightMatches(t *testing.T) {
+	const (
+		red   = "\u001b[31m"
+		green = "\u001b[32m"
+		match = "\u001b[7m"
+		off   = string(reset)
+	)
+
+	tests := []struct {
+		text  string
+		query string
+		from  int
+		want  string
+	}{
+		{"no match", "xyz", 0, "no match"},
+		{"plain text", "text", 0, "plain " + match + "text" + off},
+		{red + "bob" + off + ": hi bob", "bob", 0,
+			red + match + "bob" + off + red + off + ": hi " + match + "bob" + off},
+		{green + ">green text" + off, "een t", 0,
+			green + ">gr" + match + "een t" + off + green + "ext" + off},
+		{"a" + red + "b" + off + "c", "abc", 0,
+			match + "a" + red + match + "b" + off + match + "c" + off},
+		// only the body after the timestamp and the nick
+		{red + "[1:05PM]" + off + "bob: 1 PM", "PM", 13,
+			red + "[1:05PM]" + off + "bob: 1 " + match + "PM" + off},
+		{"[1:05PM]bob: hi bob", "^bob", 13, "[1:05PM]bob: hi bob"},
+	}
+
+	for _, tt := range tests {
+		re, err := compileSearch(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := highlightMatches(tt.text, re, color(match), tt.from)
+		if got != tt.want {
+			t.Errorf("highlightMatches(%q, %q) = %q, want %q", tt.text, tt.query, got, tt.want)
+		}
+		if stripANSI(got) != stripANSI(tt.text) {
+			t.Errorf("highlightMatches(%q, %q) changed the text to %q", tt.text, tt.query, stripANSI(got))
+		}
+	}
+}
+
+func TestSearchBody(t *testing.T) {
+	cfg := testConfig()
+	cfg.FlairBadges = true
+	c := newTestChat(t, cfg, &fakeSession{})
+	c.renderMessage(dggchat.Message{
+		Sender:    dggchat.User{Nick: "bob", Features: []string{dggchat.FeatureModerator}},
+		Timestamp: time.Date(2020, 5, 1, 13, 5, 0, 0, time.Local),
+		Message:   "1 PM bob: hi",
+	}, true)
+	c.renderCommand("bob banned by mod")
+
+	gw := c.guiwrapper
+	gw.RLock()
+	defer gw.RUnlock()
+	if got := body(gw.messages[0]); got != "1 PM bob: hi" {
+		t.Errorf("body of a chat message is %q", got)
+	}
+	if got := body(gw.messages[1]); got != "bob banned by mod" {
+		t.Errorf("body of an event is %q", got)
+	}
+}
@@ -0,0 +1,509 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// selection is the message or user picked with the keyboard or mouse, the
+// context menu acts on it. The messages view is frozen while selecting.
+type selection struct {
+	view       string // "messages" or "users"
+	buffer     *guiwrapper
+	message    *guimessage // selected in "messages"
+	user       int         // line selected in "users"
+	autoscroll bool        // of the messages view before selecting
+}
+
+type menuItem struct {
+	label string
+	run   func(g *gocui.Gui) error
+}
+
+// contextMenu lists what can be done with the selected message or user.
+type contextMenu struct {
+	title    string
+	items    []menuItem
+	selected int
+}
+
+func (m *contextMenu) width() int {
+	w := len(m.title)
+	for _, item := range m.items {
+		if len(item.label) > w {
+			w = len(item.label)
+		}
+	}
+	return w + 2
+}
+
+// startSelection selects the newest message of the active buffer.
+func (c *chat) startSelection(g *gocui.Gui, v *gocui.View) error {
+	gw := c.buffers.active()
+	gw.RLock()
+	var newest *guimessage
+	if len(gw.messages) > 0 {
+		newest = gw.messages[len(gw.messages)-1]
+	}
+	gw.RUnlock()
+
+	if newest == nil {
+		return c.beginSelection(g, &selection{view: "users", buffer: gw})
+	}
+	return c.beginSelection(g, &selection{view: "messages", buffer: gw, message: newest})
+}
+
+func (c *chat) beginSelection(g *gocui.Gui, s *selection) error {
+	messageView, err := g.View("messages")
+	if err != nil {
+		return err
+	}
+	// freeze the messages view, see redraw()
+	s.autoscroll = messageView.Autoscroll
+	messageView.Autoscroll = false
+
+	c.selection = s
+	c.drawSelection(g)
+	_, err = g.SetCurrentView(s.view)
+	return err
+}
+
+func (c *chat) endSelection(g *gocui.Gui, v *gocui.View) error {
+	if c.selection == nil {
+		return nil
+	}
+	s := c.selection
+	c.selection = nil
+
+	messageView, err := g.View("messages")
+	if err != nil {
+		return err
+	}
+	messageView.Autoscroll = s.autoscroll
+	if s.autoscroll {
+		s.buffer.redraw()
+	} else {
+		// stay where the user scrolled to, only drop the selection
+		width, _ := messageView.Size()
+		s.buffer.RLock()
+		content, _, _ := s.buffer.content(width, nil)
+		s.buffer.RUnlock()
+		_, oy := messageView.Origin()
+		messageView.Clear()
+		fmt.Fprint(messageView, content)
+		messageView.SetOrigin(0, oy)
+	}
+
+	userView, err := g.View("users")
+	if err != nil {
+		return err
+	}
+	userView.Highlight = false
+
+	_, err = g.SetCurrentView("input")
+	return err
+}
+
+func (c *chat) moveSelection(dy int) func(*gocui.Gui, *gocui.View) error {
+	return func(g *gocui.Gui, v *gocui.View) error {
+		s := c.selection
+		if s == nil {
+			return nil
+		}
+
+		switch s.view {
+		case "messages":
+			s.buffer.RLock()
+			i := 0
+			for i < len(s.buffer.messages) && s.buffer.messages[i] != s.message {
+				i++
+			}
+			i += dy
+			if i >= len(s.buffer.messages) {
+				i = len(s.buffer.messages) - 1
+			}
+			if i < 0 {
+				i = 0
+			}
+			if len(s.buffer.messages) > 0 {
+				s.message = s.buffer.messages[i]
+			}
+			s.buffer.RUnlock()
+		case "users":
+			s.user += dy
+			if s.user >= len(c.userList) {
+				s.user = len(c.userList) - 1
+			}
+			if s.user < 0 {
+				s.user = 0
+			}
+		}
+
+		c.drawSelection(g)
+		return nil
+	}
+}
+
+// switchSelection moves the selection between the messages and the users list.
+func (c *chat) switchSelection(g *gocui.Gui, v *gocui.View) error {
+	s := c.selection
+	if s == nil {
+		return nil
+	}
+
+	userView, err := g.View("users")
+	if err != nil {
+		return err
+	}
+	if s.view == "messages" {
+		s.view = "users"
+	} else {
+		s.view = "messages"
+		userView.Highlight = false
+	}
+
+	c.drawSelection(g)
+	_, err = g.SetCurrentView(s.view)
+	return err
+}
+
+// drawSelection highlights the selected message or user and scrolls it into view.
+func (c *chat) drawSelection(g *gocui.Gui) {
+	s := c.selection
+	if s == nil {
+		return
+	}
+
+	if s.view == "users" {
+		userView, err := g.View("users")
+		if err != nil {
+			return
+		}
+		_, height := userView.Size()
+		_, oy := userView.Origin()
+		if s.user < oy {
+			oy = s.user
+		} else if s.user >= oy+height {
+			oy = s.user - height + 1
+		}
+		userView.Highlight = true
+		userView.SelBgColor = gocui.ColorWhite
+		userView.SelFgColor = gocui.ColorBlack
+		userView.SetOrigin(0, oy)
+		userView.SetCursor(0, s.user-oy)
+		return
+	}
+
+	messageView, err := g.View("messages")
+	if err != nil {
+		return
+	}
+	width, height := messageView.Size()
+
+	// drawn like redraw does, clickLine counts the unread marker as well
+	target, lines := 0, 1
+	s.buffer.RLock()
+	content, _, _ := s.buffer.content(width, func(m *guimessage, text string, line int) string {
+		if m != s.message {
+			return text
+		}
+		text = stripANSI(text)
+		target, lines = line, wrappedLines(text, width)
+		return fmt.Sprintf("%s%s%s", Reversed, text, reset)
+	})
+	s.buffer.RUnlock()
+
+	messageView.Clear()
+	fmt.Fprint(messageView, content)
+
+	_, oy := messageView.Origin()
+	if target < oy {
+		oy = target
+	} else if target+lines > oy+height {
+		oy = target + lines - height
+	}
+	messageView.SetOrigin(0, oy)
+}
+
+// selected returns the nick and text of a selection.
+func (c *chat) selected(s *selection) (nick string, text string) {
+	if s == nil {
+		return "", ""
+	}
+
+	if s.view == "users" {
+		if s.user >= 0 && s.user < len(c.userList) {
+			return c.userList[s.user], c.userList[s.user]
+		}
+		return "", ""
+	}
+
+	s.buffer.RLock()
+	defer s.buffer.RUnlock()
+	if s.message == nil {
+		return "", ""
+	}
+	nick = s.message.nick
+	if nick == "" && s.buffer.private {
+		nick = s.buffer.name
+	}
+	return nick, stripANSI(s.message.msg)
+}
+
+// clickLine selects the message or user under the mouse and opens the
+// context menu. While the moderation panel is open, it only picks the target
+// of the quick actions.
+func (c *chat) clickLine(g *gocui.Gui, v *gocui.View) error {
+	_, cy := v.Cursor()
+	_, oy := v.Origin()
+	s := &selection{view: v.Name(), buffer: c.buffers.active()}
+
+	switch v.Name() {
+	case "users":
+		s.user = oy + cy
+		if s.user < 0 || s.user >= len(c.userList) {
+			return nil
+		}
+	case "messages":
+		width, _ := v.Size()
+		s.buffer.RLock()
+		s.message = s.buffer.messageAt(oy+cy, width)
+		s.buffer.RUnlock()
+		if s.message == nil {
+			return nil
+		}
+	}
+
+	modView, err := g.View("moderation")
+	if err != nil {
+		return err
+	}
+	if modView.Visible {
+		nick, _ := c.selected(s)
+		if nick == "" {
+			return nil
+		}
+		c.modLog.setTarget(nick)
+		c.drawModeration(modView)
+		_, err = g.SetCurrentView("moderation")
+		return err
+	}
+
+	if err := c.beginSelection(g, s); err != nil {
+		return err
+	}
+	return c.openMenu(g, v)
+}
+
+// menuItems builds the context menu for a nick, the commands are run like typed ones.
+func (c *chat) menuItems(nick string, text string) []menuItem {
+	run := func(tokens ...string) func(g *gocui.Gui) error {
+		return func(g *gocui.Gui) error {
+			if cmd, ok := c.commands[tokens[0]]; ok {
+				return cmd.c(c, tokens)
+			}
+			return fmt.Errorf("unknown command: %s", tokens[0])
+		}
+	}
+	// commands that need more input are put into the input view
+	prepare := func(line string) func(g *gocui.Gui) error {
+		return func(g *gocui.Gui) error {
+			if err := c.endSelection(g, nil); err != nil {
+				return err
+			}
+			c.input.set(line)
+			return nil
+		}
+	}
+
+	var items []menuItem
+	if nick != "" {
+		user := strings.ToLower(nick)
+		c.config.RLock()
+		_, tagged := c.config.Tags[user]
+		ignored := contains(c.config.Ignores, user)
+		stalked := contains(c.config.Stalks, user)
+		c.config.RUnlock()
+
+		items = append(items,
+			menuItem{"whisper", prepare(fmt.Sprintf("/w %s ", nick))},
+			menuItem{"tag with color", prepare(fmt.Sprintf("/tag %s ", nick))},
+		)
+		if tagged {
+			items = append(items, menuItem{"untag", run("/untag", nick)})
+		}
+		items = append(items, menuItem{"highlight", run("/highlight", "--nick", nick)})
+		if ignored {
+			items = append(items, menuItem{"unignore", run("/unignore", nick)})
+		} else {
+			items = append(items, menuItem{"ignore", run("/ignore", nick)})
+		}
+		if stalked {
+			items = append(items, menuItem{"unstalk", run("/unstalk", nick)})
+		} else {
+			items = append(items, menuItem{"stalk", run("/stalk", nick)})
+		}
+		items = append(items, menuItem{"recent messages", run("/history", nick)})
+	}
+	if text != "" {
+		items = append(items, menuItem{"copy text", func(g *gocui.Gui) error {
+			c.copyText(text)
+			c.renderCommand(fmt.Sprintf("Copied %s", text))
+			return nil
+		}})
+	}
+	if nick != "" && c.privileged() {
+		items = append(items,
+			menuItem{"mute", func(g *gocui.Gui) error {
+				c.modLog.setTarget(nick)
+				return c.quickMute(nick)
+			}},
+			menuItem{"ban", prepare(fmt.Sprintf("/ban %s ", nick))},
+		)
+	}
+	return items
+}
+
+func (c *chat) openMenu(g *gocui.Gui, v *gocui.View) error {
+	nick, text := c.selected(c.selection)
+	items := c.menuItems(nick, text)
+	if len(items) == 0 {
+		return nil
+	}
+
+	title := nick
+	if title == "" {
+		title = "message"
+	}
+	c.menu = &contextMenu{title: title, items: items}
+
+	menuView, err := g.View("menu")
+	if err != nil {
+		return err
+	}
+	menuView.Visible = true
+	if _, err := g.SetViewOnTop("menu"); err != nil {
+		return err
+	}
+	c.drawMenu(menuView)
+	_, err = g.SetCurrentView("menu")
+	return err
+}
+
+func (c *chat) closeMenu(g *gocui.Gui, v *gocui.View) error {
+	c.menu = nil
+	menuView, err := g.View("menu")
+	if err != nil {
+		return err
+	}
+	menuView.Visible = false
+
+	view := "input"
+	if c.selection != nil {
+		view = c.selection.view
+	}
+	_, err = g.SetCurrentView(view)
+	return err
+}
+
+func (c *chat) moveMenu(dy int) func(*gocui.Gui, *gocui.View) error {
+	return func(g *gocui.Gui, v *gocui.View) error {
+		if c.menu == nil {
+			return nil
+		}
+		c.menu.selected += dy
+		if c.menu.selected >= len(c.menu.items) {
+			c.menu.selected = len(c.menu.items) - 1
+		}
+		if c.menu.selected < 0 {
+			c.menu.selected = 0
+		}
+		c.drawMenu(v)
+		return nil
+	}
+}
+
+// runMenuItem closes the menu and runs the selected item, errors are shown in chat.
+func (c *chat) runMenuItem(g *gocui.Gui, v *gocui.View) error {
+	if c.menu == nil {
+		return nil
+	}
+	item := c.menu.items[c.menu.selected]
+	if err := c.closeMenu(g, v); err != nil {
+		return err
+	}
+	if err := item.run(g); err != nil {
+		c.renderError(err.Error())
+	}
+	return nil
+}
+
+func (c *chat) clickMenu(g *gocui.Gui, v *gocui.View) error {
+	if c.menu == nil {
+		return nil
+	}
+	_, cy := v.Cursor()
+	_, oy := v.Origin()
+	if y := oy + cy; y >= 0 && y < len(c.menu.items) {
+		c.menu.selected = y
+		return c.runMenuItem(g, v)
+	}
+	return nil
+}
+
+func (c *chat) drawMenu(v *gocui.View) {
+	if c.menu == nil {
+		return
+	}
+	v.Clear()
+	v.Title = fmt.Sprintf(" %s ", c.menu.title)
+	for i, item := range c.menu.items {
+		line := fmt.Sprintf(" %-*s", c.menu.width()-1, item.label)
+		if i == c.menu.selected {
+			line = fmt.Sprintf("%s%s%s", Reversed, line, reset)
+		}
+		fmt.Fprintln(v, line)
+	}
+}
+
+func (c *chat) setSelectionKeybindings(g *gocui.Gui) error {
+	bindings := []struct {
+		view    string
+		key     interface{}
+		handler func(*gocui.Gui, *gocui.View) error
+	}{
+		{"menu", gocui.KeyArrowUp, c.moveMenu(-1)},
+		{"menu", gocui.KeyArrowDown, c.moveMenu(1)},
+		{"menu", gocui.KeyEnter, c.runMenuItem},
+		{"menu", gocui.KeyEsc, c.closeMenu},
+		{"menu", gocui.MouseLeft, c.clickMenu},
+	}
+	for _, b := range bindings {
+		if err := g.SetKeybinding(b.view, b.key, gocui.ModNone, b.handler); err != nil {
+			return err
+		}
+	}
+
+	// the same keys select in the messages view and the users list
+	for _, view := range []string{"messages", "users"} {
+		keys := []struct {
+			key     interface{}
+			handler func(*gocui.Gui, *gocui.View) error
+		}{
+			{gocui.KeyArrowUp, c.moveSelection(-1)},
+			{gocui.KeyArrowDown, c.moveSelection(1)},
+			{gocui.KeyTab, c.switchSelection},
+			{gocui.KeyEnter, c.openMenu},
+			{gocui.KeyEsc, c.endSelection},
+			{gocui.MouseLeft, c.clickLine},
+		}
+		for _, k := range keys {
+			if err := g.SetKeybinding(view, k.key, gocui.ModNone, k.handler); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
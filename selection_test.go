@@ -0,0 +1,76 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+func menuLabels(items []menuItem) []string {
+	labels := make([]string, 0, len(items))
+	for _, item := range items {
+		labels = append(labels, item.label)
+	}
+	return labels
+}
+
+func TestContextMenu(t *testing.T) {
+	defer func(f string) { configFile = f }(configFile)
+	configFile = filepath.Join(t.TempDir(), "config.toml")
+
+	s := &fakeSession{users: []dggchat.User{{Nick: "tester"}}}
+	c := newTestChat(t, testConfig(), s)
+
+	want := []string{"whisper", "tag with color", "highlight", "ignore", "stalk", "recent messages", "copy text"}
+	items := c.menuItems("bob", "bob: hi")
+	if got := menuLabels(items); !reflect.DeepEqual(got, want) {
+		t.Fatalf("menu %q, want %q", got, want)
+	}
+
+	// items run the commands like typed ones
+	for _, item := range items {
+		if item.label == "ignore" {
+			if err := item.run(nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if !contains(c.config.Ignores, "bob") {
+		t.Errorf("bob not ignored, ignores %q", c.config.Ignores)
+	}
+	if got := menuLabels(c.menuItems("bob", "")); !contains(got, "unignore") || contains(got, "copy text") {
+		t.Errorf("menu after ignoring %q", got)
+	}
+
+	s.users = []dggchat.User{{Nick: "tester", Features: []string{"moderator"}}}
+	items = c.menuItems("bob", "")
+	if got := menuLabels(items); !contains(got, "mute") || !contains(got, "ban") {
+		t.Fatalf("no mod actions for moderators in %q", got)
+	}
+	for _, item := range items {
+		if item.label == "mute" {
+			item.run(nil)
+		}
+	}
+	if want := []string{"MUTE bob 0s"}; !reflect.DeepEqual(s.messages(), want) {
+		t.Errorf("sent %q, want %q", s.messages(), want)
+	}
+}
+
+func TestSelected(t *testing.T) {
+	c := newTestChat(t, testConfig(), &fakeSession{})
+	c.userList = []string{"alice", "bob"}
+	if nick, _ := c.selected(&selection{view: "users", user: 1}); nick != "bob" {
+		t.Errorf("selected user %q, want bob", nick)
+	}
+
+	pm := c.buffers.private("eve")
+	pm.addMessage(guimessage{ts: time.Now(), tag: "   ", msg: "[PM <- eve] psst"})
+	nick, text := c.selected(&selection{view: "messages", buffer: pm, message: pm.messages[0]})
+	if nick != "eve" || text != "[PM <- eve] psst" {
+		t.Errorf("selected %q %q in a whisper buffer", nick, text)
+	}
+}
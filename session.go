@@ -0,0 +1,144 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+	"github.com/gorilla/websocket"
+)
+
+// session is the part of *dggchat.Session used by tsgg, so tests can replace it.
+type session interface {
+	Open() error
+	Close() error
+	SetDialer(d websocket.Dialer)
+
+	GetUsers() []dggchat.User
+
+	SendMessage(message string) error
+	SendAction(message string) error
+	SendPrivateMessage(nick string, message string) error
+	SendMute(nick string, duration time.Duration) error
+	SendUnmute(nick string) error
+	SendBan(nick string, reason string, duration time.Duration, banip bool) error
+	SendPermanentBan(nick string, reason string, banip bool) error
+	SendUnban(nick string) error
+	SendSubOnly(subonly bool) error
+	SendBroadcast(message string) error
+	SendPing() error
+
+	AddMessageHandler(fn func(dggchat.Message, *dggchat.Session))
+	AddNamesHandler(fn func(dggchat.Names, *dggchat.Session))
+	AddMuteHandler(fn func(dggchat.Mute, *dggchat.Session))
+	AddUnmuteHandler(fn func(dggchat.Mute, *dggchat.Session))
+	AddBanHandler(fn func(dggchat.Ban, *dggchat.Session))
+	AddUnbanHandler(fn func(dggchat.Ban, *dggchat.Session))
+	AddErrorHandler(fn func(string, *dggchat.Session))
+	AddJoinHandler(fn func(dggchat.RoomAction, *dggchat.Session))
+	AddQuitHandler(fn func(dggchat.RoomAction, *dggchat.Session))
+	AddPMHandler(fn func(dggchat.PrivateMessage, *dggchat.Session))
+	AddBroadcastHandler(fn func(dggchat.Broadcast, *dggchat.Session))
+	AddPingHandler(fn func(dggchat.Ping, *dggchat.Session))
+	AddSubOnlyHandler(fn func(dggchat.SubOnly, *dggchat.Session))
+	AddSocketErrorHandler(fn func(error, *dggchat.Session))
+}
+
+func newSession(config *config) (*dggchat.Session, error) {
+	sgg, err := dggchat.New(";jwt=" + config.AuthToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.CustomURL != "" {
+		url, err := url.Parse(config.CustomURL)
+		if err != nil {
+			return nil, err
+		}
+		sgg.SetURL(*url)
+	}
+	return sgg, nil
+}
+
+// addHandlers renders and logs everything received from the session.
+func (c *chat) addHandlers() {
+	c.Session.AddNamesHandler(func(n dggchat.Names, s *dggchat.Session) {
+		c.renderCommand("Connected!")
+		c.status.setConnected(len(n.Users))
+		c.renderUsers(n.Users)
+		// our features are known now, show the commands we may use
+		c.renderHelp()
+		// NAMES is sent on every (re)connect, fill the gap while we were gone.
+		// Fetching may take a while, live messages keep coming in meanwhile.
+		if c.history != nil && c.history.reconnected() {
+			go c.loadHistory(true)
+		}
+	})
+	c.Session.AddSocketErrorHandler(func(err error, s *dggchat.Session) {
+		c.renderError(err.Error() + " - Trying to reconnect...")
+		c.status.setDisconnected()
+		if c.history != nil {
+			c.history.setDisconnected()
+		}
+	})
+	c.Session.AddMessageHandler(func(m dggchat.Message, s *dggchat.Session) {
+		c.logEvent(messageEntry(m))
+		if c.history != nil {
+			c.history.markSeen(m)
+		}
+		c.renderMessage(m, true)
+	})
+	c.Session.AddErrorHandler(func(e string, s *dggchat.Session) {
+		c.renderError(e)
+	})
+	c.Session.AddMuteHandler(func(m dggchat.Mute, s *dggchat.Session) {
+		c.logEvent(muteEntry("MUTE", m))
+		c.renderMute(m)
+	})
+	c.Session.AddUnmuteHandler(func(m dggchat.Mute, s *dggchat.Session) {
+		c.logEvent(muteEntry("UNMUTE", m))
+		c.renderUnmute(m)
+	})
+	c.Session.AddBanHandler(func(b dggchat.Ban, s *dggchat.Session) {
+		c.logEvent(banEntry("BAN", b))
+		c.renderBan(b)
+	})
+	c.Session.AddUnbanHandler(func(b dggchat.Ban, s *dggchat.Session) {
+		c.logEvent(banEntry("UNBAN", b))
+		c.renderUnban(b)
+	})
+	c.Session.AddJoinHandler(func(r dggchat.RoomAction, s *dggchat.Session) {
+		c.logEvent(roomActionEntry("JOIN", r))
+		c.renderJoin(r, true)
+		users := c.Session.GetUsers()
+		c.status.setUsers(len(users))
+		c.renderUsers(users)
+		// our features may have changed, e.g. after being modded
+		if c.username != "" && strings.EqualFold(r.User.Nick, c.username) {
+			c.renderHelp()
+		}
+	})
+	c.Session.AddQuitHandler(func(r dggchat.RoomAction, s *dggchat.Session) {
+		c.logEvent(roomActionEntry("QUIT", r))
+		c.renderQuit(r)
+		users := c.Session.GetUsers()
+		c.status.setUsers(len(users))
+		c.renderUsers(users)
+	})
+	c.Session.AddSubOnlyHandler(func(so dggchat.SubOnly, s *dggchat.Session) {
+		c.logEvent(subOnlyEntry(so))
+		c.renderSubOnly(so)
+	})
+	c.Session.AddBroadcastHandler(func(b dggchat.Broadcast, s *dggchat.Session) {
+		c.logEvent(broadcastEntry(b))
+		c.renderBroadcast(b)
+	})
+	c.Session.AddPMHandler(func(pm dggchat.PrivateMessage, s *dggchat.Session) {
+		c.logEvent(privateMessageEntry(pm))
+		c.renderPrivateMessage(pm)
+	})
+	c.Session.AddPingHandler(func(p dggchat.Ping, s *dggchat.Session) {
+		c.status.pong(p)
+	})
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond until it is true or a timeout is reached.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func countLines(gw *guiwrapper, s string) int {
+	n := 0
+	for _, l := range lines(gw) {
+		if strings.Contains(l, s) {
+			n++
+		}
+	}
+	return n
+}
+
+// connectTestChat connects a chat using the real dggchat session to srv.
+func connectTestChat(t *testing.T, srv *testServer) *chat {
+	t.Helper()
+	cfg := testConfig()
+	cfg.CustomURL = srv.url()
+
+	sgg, err := newSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newTestChat(t, cfg, sgg)
+	if err := c.Session.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Session.Close() })
+
+	waitFor(t, "NAMES", func() bool { return countLines(c.guiwrapper, "Connected!") == 1 })
+	return c
+}
+
+func TestSessionEndToEnd(t *testing.T) {
+	srv := newTestServer(t, "tester", "bob", "alice")
+	c := connectTestChat(t, srv)
+
+	if users := c.Session.GetUsers(); len(users) != 3 {
+		t.Errorf("got %d users, want 3", len(users))
+	}
+
+	c.handleInput("hello chat")
+	if got, want := srv.next(t), `MSG {"data":"hello chat"}`; got != want {
+		t.Errorf("server received %s, want %s", got, want)
+	}
+	waitFor(t, "echoed message", func() bool { return countLines(c.guiwrapper, "tester: hello chat") == 1 })
+
+	c.handleInput("/w bob psst")
+	if got, want := srv.next(t), `PRIVMSG {"nick":"bob","data":"psst"}`; got != want {
+		t.Errorf("server received %s, want %s", got, want)
+	}
+
+	// we are no moderator, the command doesn't reach the server
+	c.handleInput("/unmute bob")
+	if countLines(c.guiwrapper, "/unmute is only available to moderators") != 1 {
+		t.Errorf("no local error for a privileged command, rendered %q", lines(c.guiwrapper))
+	}
+	c.handleInput("still here")
+	if got, want := srv.next(t), `MSG {"data":"still here"}`; got != want {
+		t.Errorf("server received %s, want %s", got, want)
+	}
+
+	srv.broadcast("PRIVMSG", srv.privateMessage("alice", "hi tester"))
+	waitFor(t, "whisper", func() bool { return countLines(c.buffers.private("alice"), "hi tester") == 1 })
+
+	srv.broadcast("JOIN", srv.event("carol", ""))
+	waitFor(t, "JOIN", func() bool { return len(c.Session.GetUsers()) == 4 })
+	srv.broadcast("QUIT", srv.event("bob", ""))
+	waitFor(t, "QUIT", func() bool { return len(c.Session.GetUsers()) == 3 })
+
+	srv.broadcast("MUTE", srv.event("mod", "alice"))
+	waitFor(t, "MUTE", func() bool { return countLines(c.guiwrapper, "alice muted by mod") == 1 })
+	srv.broadcast("BAN", srv.event("mod", "alice"))
+	waitFor(t, "BAN", func() bool { return countLines(c.guiwrapper, "alice banned by mod") == 1 })
+}
+
+func TestSessionReconnect(t *testing.T) {
+	srv := newTestServer(t, "tester")
+	c := connectTestChat(t, srv)
+
+	waitFor(t, "connected status", func() bool {
+		c.status.Lock()
+		defer c.status.Unlock()
+		return c.status.state == stateConnected
+	})
+
+	srv.drop()
+	waitFor(t, "reconnect", func() bool { return countLines(c.guiwrapper, "Connected!") == 2 })
+
+	if n := srv.connections(); n != 2 {
+		t.Errorf("server saw %d connections, want 2", n)
+	}
+	if n := countLines(c.guiwrapper, "Trying to reconnect..."); n != 1 {
+		t.Errorf("rendered %d socket errors, want 1", n)
+	}
+
+	c.status.Lock()
+	state, attempts := c.status.state, c.status.attempts
+	c.status.Unlock()
+	if state != stateConnected || attempts != 0 {
+		t.Errorf("status is %s with %d attempts, want connected with 0", state, attempts)
+	}
+
+	c.handleInput("still here")
+	if got, want := srv.next(t), `MSG {"data":"still here"}`; got != want {
+		t.Errorf("server received %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+	"github.com/awesome-gocui/gocui"
+	"github.com/gorilla/websocket"
+)
+
+const pingInterval = 30 * time.Second
+
+type connectionState int
+
+const (
+	stateConnecting connectionState = iota
+	stateConnected
+	stateReconnecting
+)
+
+func (s connectionState) String() string {
+	switch s {
+	case stateConnected:
+		return "connected"
+	case stateReconnecting:
+		return "reconnecting"
+	}
+	return "connecting"
+}
+
+// status is rendered into the status bar at the bottom of the screen.
+type status struct {
+	gui      updater
+	theme    *theme
+	nick     string
+	state    connectionState
+	attempts int // dial attempts since the connection was lost
+	latency  time.Duration
+	pingSent time.Time
+	users    int
+	subOnly  bool
+	dnd      bool
+	sync.Mutex
+}
+
+// dialer wraps the default websocket dialer, so every (re)connection attempt
+// made by dggchat can be counted.
+func (s *status) dialer() websocket.Dialer {
+	d := *websocket.DefaultDialer
+	d.NetDialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		s.Lock()
+		s.attempts++
+		s.Unlock()
+		s.render()
+
+		var nd net.Dialer
+		return nd.DialContext(ctx, network, addr)
+	}
+	return d
+}
+
+func (s *status) setConnected(users int) {
+	s.Lock()
+	s.state = stateConnected
+	s.attempts = 0
+	s.users = users
+	s.Unlock()
+	s.render()
+}
+
+func (s *status) setDisconnected() {
+	s.Lock()
+	s.state = stateReconnecting
+	s.attempts = 0
+	s.latency = 0
+	s.Unlock()
+	s.render()
+}
+
+func (s *status) setUsers(users int) {
+	s.Lock()
+	s.users = users
+	s.Unlock()
+	s.render()
+}
+
+func (s *status) setSubOnly(active bool) {
+	s.Lock()
+	s.subOnly = active
+	s.Unlock()
+	s.render()
+}
+
+func (s *status) setDND(dnd bool) {
+	s.Lock()
+	s.dnd = dnd
+	s.Unlock()
+	s.render()
+}
+
+func (s *status) ping() {
+	s.Lock()
+	s.pingSent = time.Now()
+	s.Unlock()
+}
+
+// pong measures the round-trip time of the last ping. The timestamp echoed by
+// the server only has second precision, so it is only used as a fallback.
+func (s *status) pong(p dggchat.Ping) {
+	s.Lock()
+	if !s.pingSent.IsZero() {
+		s.latency = time.Since(s.pingSent)
+		s.pingSent = time.Time{}
+	} else {
+		s.latency = time.Since(time.Unix(p.Timestamp/1000, 0))
+	}
+	s.Unlock()
+	s.render()
+}
+
+func (s *status) render() {
+	s.Lock()
+	parts := []string{}
+	switch {
+	case s.state == stateConnected:
+		parts = append(parts, fmt.Sprintf("%s%s%s", s.theme.get("connected"), s.state, reset))
+	case s.state == stateReconnecting && s.attempts > 0:
+		parts = append(parts, fmt.Sprintf("%s%s (attempt %d)%s", s.theme.get("disconnected"), s.state, s.attempts, reset))
+	default:
+		parts = append(parts, fmt.Sprintf("%s%s%s", s.theme.get("disconnected"), s.state, reset))
+	}
+	if s.nick != "" {
+		parts = append(parts, s.nick)
+	}
+	parts = append(parts, fmt.Sprintf("%d users", s.users))
+	if s.latency > 0 {
+		parts = append(parts, fmt.Sprintf("%dms", s.latency.Milliseconds()))
+	}
+	if s.subOnly {
+		parts = append(parts, fmt.Sprintf("%ssubonly%s", s.theme.get("subonly"), reset))
+	}
+	if s.dnd {
+		parts = append(parts, fmt.Sprintf("%sdnd%s", s.theme.get("dnd"), reset))
+	}
+	s.Unlock()
+
+	s.gui.Update(func(g *gocui.Gui) error {
+		statusView, err := g.View("status")
+		if err != nil {
+			return err
+		}
+		statusView.Clear()
+		fmt.Fprint(statusView, " "+strings.Join(parts, " | "))
+		return nil
+	})
+}
+
+// pinger periodically pings the server to measure latency.
+func (c *chat) pinger() {
+	for {
+		c.status.ping()
+		if err := c.Session.SendPing(); err != nil {
+			c.renderDebug(fmt.Sprintf("ping: %v", err))
+		}
+		time.Sleep(pingInterval)
+	}
+}
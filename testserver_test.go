@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+	"github.com/gorilla/websocket"
+)
+
+// testServer is an in-process chat server speaking the sgg wire protocol.
+// Every client gets NAMES on connect, messages sent by clients are echoed
+// back like the real server does.
+type testServer struct {
+	*httptest.Server
+	nick     string // nick of the connecting client
+	users    []dggchat.User
+	received chan string // everything sent by clients
+
+	conns    []*websocket.Conn
+	connects int
+	sync.Mutex
+}
+
+func newTestServer(t *testing.T, nick string, users ...string) *testServer {
+	s := &testServer{
+		nick:     nick,
+		received: make(chan string, 100),
+	}
+	for _, u := range append([]string{nick}, users...) {
+		s.users = append(s.users, dggchat.User{Nick: u, Features: []string{}})
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.close)
+	return s
+}
+
+// url is the websocket url of the server, for the custom_url config.
+func (s *testServer) url() string {
+	return "ws" + strings.TrimPrefix(s.Server.URL, "http") + "/ws"
+}
+
+func (s *testServer) handle(w http.ResponseWriter, r *http.Request) {
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	s.Lock()
+	s.conns = append(s.conns, conn)
+	s.connects++
+	s.Unlock()
+
+	s.write(conn, "NAMES", map[string]interface{}{
+		"connectioncount": len(s.users),
+		"users":           s.users,
+	})
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		s.received <- string(message)
+		s.reply(conn, string(message))
+	}
+}
+
+// reply answers client messages the way the chat server does.
+func (s *testServer) reply(conn *websocket.Conn, message string) {
+	mslice := strings.SplitN(message, " ", 2)
+	if len(mslice) != 2 {
+		s.write(conn, "ERR", "protocolerror")
+		return
+	}
+
+	var data struct {
+		Data      string `json:"data"`
+		Nick      string `json:"nick"`
+		Timestamp int64  `json:"timestamp"`
+	}
+	if err := json.Unmarshal([]byte(mslice[1]), &data); err != nil {
+		s.write(conn, "ERR", "protocolerror")
+		return
+	}
+
+	switch mslice[0] {
+	case "MSG":
+		s.broadcast("MSG", s.event(s.nick, data.Data))
+	case "PRIVMSG":
+		s.write(conn, "PRIVMSGSENT", "")
+	case "PING":
+		s.write(conn, "PONG", map[string]int64{"timestamp": data.Timestamp})
+	default:
+		s.write(conn, "ERR", "nopermission")
+	}
+}
+
+// event builds the payload of MSG, MUTE, BAN, JOIN and QUIT events.
+func (s *testServer) event(nick string, data string) map[string]interface{} {
+	return map[string]interface{}{
+		"nick":      nick,
+		"features":  []string{},
+		"timestamp": time.Now().UnixNano() / int64(time.Millisecond),
+		"data":      data,
+	}
+}
+
+// privateMessage builds the payload of a PRIVMSG event.
+func (s *testServer) privateMessage(nick string, data string) map[string]interface{} {
+	return map[string]interface{}{
+		"messageid": 1,
+		"nick":      nick,
+		"timestamp": time.Now().UnixNano() / int64(time.Millisecond),
+		"data":      data,
+	}
+}
+
+func (s *testServer) write(conn *websocket.Conn, typ string, payload interface{}) {
+	b, _ := json.Marshal(payload)
+	s.Lock()
+	defer s.Unlock()
+	conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("%s %s", typ, b)))
+}
+
+// broadcast sends an event to all connected clients.
+func (s *testServer) broadcast(typ string, payload interface{}) {
+	s.Lock()
+	conns := append([]*websocket.Conn{}, s.conns...)
+	s.Unlock()
+	for _, conn := range conns {
+		s.write(conn, typ, payload)
+	}
+}
+
+// drop closes all client connections, the clients should reconnect.
+func (s *testServer) drop() {
+	s.Lock()
+	defer s.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *testServer) connections() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.connects
+}
+
+// next returns the next message sent by a client.
+func (s *testServer) next(t *testing.T) string {
+	t.Helper()
+	select {
+	case m := <-s.received:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a client message")
+		return ""
+	}
+}
+
+func (s *testServer) close() {
+	s.drop()
+	s.Server.Close()
+}
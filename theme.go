@@ -0,0 +1,389 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const defaultTheme = "default"
+
+// styles every theme has to define
+var styleNames = []string{
+	"timestamp",
+	"nick",
+	"own_nick",
+	"greentext",
+	"emote",
+	"unread",
+	"highlight",
+	"error",
+	"info",
+	"pm",
+	"broadcast",
+	"mod_action",
+	"subonly",
+	"join",
+	"quit",
+	"tab_current",
+	"tab_unread",
+	"tab_whisper",
+	"connected",
+	"disconnected",
+	"dnd",
+	"search_match",
+	"search_current",
+}
+
+// builtin themes, see parseStyle for the syntax
+var themes = map[string]map[string]string{
+	"default": {
+		"timestamp":      "",
+		"nick":           "bold",
+		"own_nick":       "bold cyan",
+		"greentext":      "green",
+		"emote":          "bold yellow",
+		"unread":         "brightred",
+		"highlight":      "black on white",
+		"error":          "brightred",
+		"info":           "white",
+		"pm":             "brightwhite",
+		"broadcast":      "brightyellow",
+		"mod_action":     "yellow",
+		"subonly":        "magenta",
+		"join":           "green",
+		"quit":           "red",
+		"tab_current":    "reverse",
+		"tab_unread":     "bold",
+		"tab_whisper":    "brightred",
+		"connected":      "brightgreen",
+		"disconnected":   "brightyellow",
+		"dnd":            "brightred",
+		"search_match":   "black on yellow",
+		"search_current": "reverse",
+	},
+	"mono": {
+		"timestamp":      "",
+		"nick":           "bold",
+		"own_nick":       "bold underline",
+		"greentext":      "",
+		"emote":          "bold",
+		"unread":         "bold",
+		"highlight":      "reverse",
+		"error":          "bold",
+		"info":           "",
+		"pm":             "bold",
+		"broadcast":      "bold",
+		"mod_action":     "underline",
+		"subonly":        "underline",
+		"join":           "",
+		"quit":           "",
+		"tab_current":    "reverse",
+		"tab_unread":     "bold",
+		"tab_whisper":    "bold underline",
+		"connected":      "",
+		"disconnected":   "bold",
+		"dnd":            "bold",
+		"search_match":   "underline",
+		"search_current": "reverse",
+	},
+	"pastel": {
+		"timestamp":      "244",
+		"nick":           "bold 153",
+		"own_nick":       "bold 215",
+		"greentext":      "114",
+		"emote":          "bold 179",
+		"unread":         "174",
+		"highlight":      "235 on 229",
+		"error":          "203",
+		"info":           "250",
+		"pm":             "218",
+		"broadcast":      "222",
+		"mod_action":     "180",
+		"subonly":        "183",
+		"join":           "108",
+		"quit":           "174",
+		"tab_current":    "reverse",
+		"tab_unread":     "bold",
+		"tab_whisper":    "bold 218",
+		"connected":      "114",
+		"disconnected":   "222",
+		"dnd":            "203",
+		"search_match":   "235 on 222",
+		"search_current": "reverse",
+	},
+}
+
+var colorNames = map[string]int{
+	"black":         0,
+	"red":           1,
+	"green":         2,
+	"yellow":        3,
+	"blue":          4,
+	"magenta":       5,
+	"cyan":          6,
+	"white":         7,
+	"gray":          8,
+	"grey":          8,
+	"brightblack":   8,
+	"brightred":     9,
+	"brightgreen":   10,
+	"brightyellow":  11,
+	"brightblue":    12,
+	"brightmagenta": 13,
+	"brightcyan":    14,
+	"brightwhite":   15,
+}
+
+// theme maps style names to escape sequences. The gui runs in 256 color
+// mode, truecolor values are approximated by the closest palette color.
+type theme struct {
+	name   string
+	styles map[string]color
+	sync.RWMutex
+}
+
+func newTheme(name string, overrides map[string]string) (*theme, error) {
+	t := &theme{}
+	if name == "" {
+		name = defaultTheme
+	}
+	return t, t.load(name, overrides)
+}
+
+// load switches to the builtin theme name, with overrides from the [styles] config table on top.
+func (t *theme) load(name string, overrides map[string]string) error {
+	base, ok := themes[name]
+	if !ok {
+		return fmt.Errorf("unknown theme %s, available themes: %s", name, strings.Join(themeNames(), ", "))
+	}
+
+	styles := make(map[string]color, len(styleNames))
+	for _, s := range styleNames {
+		spec := base[s]
+		if o, ok := overrides[s]; ok {
+			spec = o
+		}
+		c, err := parseStyle(spec)
+		if err != nil {
+			return fmt.Errorf("style %s: %v", s, err)
+		}
+		styles[s] = c
+	}
+	for s := range overrides {
+		if _, ok := base[s]; !ok {
+			return fmt.Errorf("unknown style %s, valid styles are: %s", s, strings.Join(styleNames, ", "))
+		}
+	}
+
+	t.Lock()
+	t.name = name
+	t.styles = styles
+	t.Unlock()
+	return nil
+}
+
+func (t *theme) get(style string) color {
+	t.RLock()
+	defer t.RUnlock()
+	return t.styles[style]
+}
+
+func (t *theme) current() string {
+	t.RLock()
+	defer t.RUnlock()
+	return t.name
+}
+
+func themeNames() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseStyle parses space separated style specs, e.g. "bold red", "#ff8800 underline"
+// or "235 on 229". Colors can be names, 256 color indexes or hex truecolor values,
+// the color following "on" is the background.
+func parseStyle(spec string) (color, error) {
+	var fg, bg, attrs string
+	fields := strings.Fields(strings.ToLower(spec))
+	for i := 0; i < len(fields); i++ {
+		switch f := fields[i]; f {
+		case "bold":
+			attrs += string(Bold)
+		case "underline":
+			attrs += string(Underline)
+		case "reverse":
+			attrs += string(Reversed)
+		case "on":
+			if i+1 >= len(fields) {
+				return none, fmt.Errorf("%q: missing background color after \"on\"", spec)
+			}
+			n, err := parseColor(fields[i+1])
+			if err != nil {
+				return none, err
+			}
+			bg = fmt.Sprintf("\u001b[48;5;%dm", n)
+			i++
+		default:
+			n, err := parseColor(f)
+			if err != nil {
+				return none, err
+			}
+			fg = fmt.Sprintf("\u001b[38;5;%dm", n)
+		}
+	}
+	// attributes have to come last, setting a color resets them
+	return color(fg + bg + attrs), nil
+}
+
+// parseColor returns the 256 color palette index of a color name, index or hex value.
+func parseColor(s string) (int, error) {
+	s = strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(s))
+	if n, ok := colorNames[s]; ok {
+		return n, nil
+	}
+
+	if strings.HasPrefix(s, "#") && len(s) == 7 {
+		rgb, err := strconv.ParseUint(s[1:], 16, 32)
+		if err == nil {
+			return rgbTo256(int(rgb>>16&0xff), int(rgb>>8&0xff), int(rgb&0xff)), nil
+		}
+	}
+
+	n, err := strconv.Atoi(s)
+	if err == nil && n >= 0 && n <= 255 {
+		return n, nil
+	}
+	return 0, fmt.Errorf("invalid color %q, use a color name, 0-255 or #rrggbb", s)
+}
+
+// rgbTo256 picks the closest color of the 6x6x6 cube or the grayscale ramp.
+func rgbTo256(r, g, b int) int {
+	level := func(v int) int {
+		if v < 48 {
+			return 0
+		}
+		if v < 115 {
+			return 1
+		}
+		return (v - 35) / 40
+	}
+	steps := []int{0, 95, 135, 175, 215, 255}
+	cr, cg, cb := level(r), level(g), level(b)
+	cube := 16 + 36*cr + 6*cg + cb
+
+	gray := (r + g + b) / 3
+	grayIndex := 23
+	if gray < 238 {
+		grayIndex = (gray - 3) / 10
+		if grayIndex < 0 {
+			grayIndex = 0
+		}
+	}
+	grayValue := 8 + 10*grayIndex
+
+	dist := func(x, y, z int) int {
+		return (r-x)*(r-x) + (g-y)*(g-y) + (b-z)*(b-z)
+	}
+	if dist(grayValue, grayValue, grayValue) < dist(steps[cr], steps[cg], steps[cb]) {
+		return 232 + grayIndex
+	}
+	return cube
+}
+
+// paint wraps s in the given theme style.
+func (c *chat) paint(style string, s string) string {
+	return fmt.Sprintf("%s%s%s", c.theme.get(style), s, reset)
+}
+
+// tag renders the three character wide tag in front of a message, the
+// style's colors are reversed so the tag stands out from the message.
+func (c *chat) tag(style string, symbol string) string {
+	return fmt.Sprintf(" %s%s%s%s ", c.theme.get(style), Reversed, symbol, reset)
+}
+
+// tagStyle is the background of the tag column and the color of a /tag'd nick.
+func tagStyle(name string) color {
+	style, err := parseStyle("on " + name)
+	if err != nil {
+		return none
+	}
+	return style
+}
+
+var sgrPattern = regexp.MustCompile("\u001b\\[([0-9;]*)m")
+
+// legacyHighlight turns the escape sequences of the old highlight_bg_color and
+// highlight_fg_color settings into the highlight style, unless [styles] sets it.
+func (cfg *config) legacyHighlight() error {
+	legacy := cfg.HighlightBg + cfg.HighlightFg
+	if legacy == "" {
+		return nil
+	}
+	if _, ok := cfg.Styles["highlight"]; ok {
+		return nil
+	}
+
+	spec, err := sgrStyle(legacy)
+	if err != nil {
+		return fmt.Errorf("highlight_bg_color/highlight_fg_color: %v, use the highlight style instead", err)
+	}
+	if cfg.Styles == nil {
+		cfg.Styles = make(map[string]string)
+	}
+	cfg.Styles["highlight"] = spec
+	return nil
+}
+
+// sgrStyle translates escape sequences, e.g. "\u001b[47m\u001b[30;1m", into a
+// style spec like "on white black bold".
+func sgrStyle(escapes string) (string, error) {
+	names := []string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+	if rest := sgrPattern.ReplaceAllString(escapes, ""); rest != "" {
+		return "", fmt.Errorf("%q is not an escape sequence", rest)
+	}
+
+	var spec []string
+	for _, m := range sgrPattern.FindAllStringSubmatch(escapes, -1) {
+		codes := strings.Split(m[1], ";")
+		for i := 0; i < len(codes); i++ {
+			n, err := strconv.Atoi(codes[i])
+			if err != nil {
+				return "", fmt.Errorf("invalid escape sequence %q", m[0])
+			}
+			switch {
+			case n == 0:
+			case n == 1:
+				spec = append(spec, "bold")
+			case n == 4:
+				spec = append(spec, "underline")
+			case n == 7:
+				spec = append(spec, "reverse")
+			case n >= 30 && n <= 37:
+				spec = append(spec, names[n-30])
+			case n >= 40 && n <= 47:
+				spec = append(spec, "on", names[n-40])
+			case n >= 90 && n <= 97:
+				spec = append(spec, "bright"+names[n-90])
+			case n >= 100 && n <= 107:
+				spec = append(spec, "on", "bright"+names[n-100])
+			case (n == 38 || n == 48) && i+2 < len(codes) && codes[i+1] == "5":
+				if n == 48 {
+					spec = append(spec, "on")
+				}
+				spec = append(spec, codes[i+2])
+				i += 2
+			default:
+				return "", fmt.Errorf("unsupported escape sequence %q", m[0])
+			}
+		}
+	}
+	return strings.Join(spec, " "), nil
+}
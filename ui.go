@@ -60,7 +60,7 @@ const (
 	fgBrightWhite   color = "\u001b[37;1m"
 )
 
-func layout(g *gocui.Gui) error {
+func (c *chat) layout(g *gocui.Gui) error {
 	maxX, maxY := g.Size()
 	g.Cursor = true
 
@@ -80,26 +80,7 @@ func layout(g *gocui.Gui) error {
 		messages.Title = " help: "
 		messages.Wrap = true
 
-		// command map is unordered, we want the help menu to be stable
-		keys := make([]string, 0, len(commands))
-		for key := range commands {
-			keys = append(keys, key)
-		}
-		sort.Strings(keys)
-
-		fmt.Fprint(messages, "Commands:\n")
-		for _, k := range keys {
-			if !commands[k].privileged {
-				fmt.Fprintf(messages, "  - %s %s\n", k, commands[k].usage)
-			}
-		}
-		// TODO: only print those if user can use them, and remove the pasted loop.
-		for _, k := range keys {
-			if commands[k].privileged {
-				fmt.Fprintf(messages, "  * %s %s\n", k, commands[k].usage)
-			}
-		}
-
+		// filled by renderHelp, it changes with aliases
 	}
 
 	xDimension := maxX - 20
@@ -107,7 +88,13 @@ func layout(g *gocui.Gui) error {
 		xDimension = maxX - 1
 	}
 
-	if messages, err := g.SetView("messages", 0, 0, xDimension, maxY-3, 0); err != nil {
+	// the input view grows with multi-line input, pushing the views above it up
+	grow := c.input.lineCount() - 1
+	if grow > maxInputLines-1 {
+		grow = maxInputLines - 1
+	}
+
+	if messages, err := g.SetView("messages", 0, 0, xDimension, maxY-6-grow, 0); err != nil {
 		if !gocui.IsUnknownView(err) {
 			return err
 		}
@@ -116,19 +103,83 @@ func layout(g *gocui.Gui) error {
 		messages.Wrap = true
 	}
 
-	if input, err := g.SetView("input", 0, maxY-3, xDimension, maxY-1, 0); err != nil {
+	if tabs, err := g.SetView("tabs", 0, maxY-6-grow, xDimension, maxY-4-grow, 0); err != nil {
+		if !gocui.IsUnknownView(err) {
+			return err
+		}
+		tabs.Frame = false
+		tabs.Wrap = false
+	}
+
+	input, err := g.SetView("input", 0, maxY-4-grow, xDimension, maxY-2, 0)
+	if err != nil {
 		if !gocui.IsUnknownView(err) {
 			return err
 		}
-		input.Title = " send: "
 		input.Autoscroll = false
-		input.Wrap = true
+		// renderInput scrolls long lines instead
+		input.Wrap = false
 		input.Editable = true
+		input.Editor = gocui.EditorFunc(c.edit)
 
 		g.SetCurrentView("input")
 	}
+	// redrawn every frame, the view size changes with the number of lines
+	c.renderInput(input)
+
+	if err := c.renderCompletions(g, 0, maxY-4-grow, xDimension); err != nil {
+		return err
+	}
+
+	// search prompt overlays the input view while active
+	if search, err := g.SetView("search", 0, maxY-4-grow, xDimension, maxY-2, 0); err != nil {
+		if !gocui.IsUnknownView(err) {
+			return err
+		}
+		search.Editable = true
+		search.Wrap = false
+		search.Visible = false
+	}
+
+	if links, err := g.SetView("links", maxX/6, maxY/6, maxX/6*5, maxY/6*5, 0); err != nil {
+		if !gocui.IsUnknownView(err) {
+			return err
+		}
+		links.Wrap = false
+		links.Visible = false
+	}
+
+	if moderation, err := g.SetView("moderation", maxX/6, maxY/6, maxX/6*5, maxY/6*5, 0); err != nil {
+		if !gocui.IsUnknownView(err) {
+			return err
+		}
+		moderation.Wrap = false
+		moderation.Visible = false
+	}
+
+	if history, err := g.SetView("userhistory", maxX/6, maxY/6, maxX/6*5, maxY/6*5, 0); err != nil {
+		if !gocui.IsUnknownView(err) {
+			return err
+		}
+		history.Wrap = true
+		history.Visible = false
+	}
 
-	if users, err := g.SetView("users", maxX-20, 0, maxX-1, maxY-1, 0); err != nil {
+	// the context menu is sized to its items
+	menuWidth, menuHeight := 20, 2
+	if c.menu != nil {
+		menuWidth, menuHeight = c.menu.width()+1, len(c.menu.items)+1
+	}
+	menuX, menuY := (maxX-menuWidth)/2, (maxY-menuHeight)/2
+	if menu, err := g.SetView("menu", menuX, menuY, menuX+menuWidth, menuY+menuHeight, 0); err != nil {
+		if !gocui.IsUnknownView(err) {
+			return err
+		}
+		menu.Wrap = false
+		menu.Visible = false
+	}
+
+	if users, err := g.SetView("users", maxX-20, 0, maxX-1, maxY-2, 0); err != nil {
 		if !gocui.IsUnknownView(err) {
 			return err
 		}
@@ -137,6 +188,16 @@ func layout(g *gocui.Gui) error {
 		users.Wrap = false
 	}
 
+	if status, err := g.SetView("status", -1, maxY-2, maxX, maxY, 0); err != nil {
+		if !gocui.IsUnknownView(err) {
+			return err
+		}
+		status.Frame = false
+		status.Wrap = false
+		status.BgColor = gocui.ColorBlue
+		status.FgColor = gocui.ColorWhite
+	}
+
 	return nil
 }
 
@@ -150,6 +211,56 @@ func (c *chat) showHelp(g *gocui.Gui, v *gocui.View) error {
 	return err
 }
 
+// helpText lists the commands we may use and all aliases.
+func (c *chat) helpText() string {
+	// command map is unordered, we want the help menu to be stable,
+	// privileged commands come last
+	keys := make([]string, 0, len(c.commands))
+	for key, cmd := range c.commands {
+		if c.visible(cmd) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if c.commands[keys[i]].privileged != c.commands[keys[j]].privileged {
+			return !c.commands[keys[i]].privileged
+		}
+		return keys[i] < keys[j]
+	})
+
+	var help strings.Builder
+	help.WriteString("Commands:\n")
+	for _, k := range keys {
+		bullet := "-"
+		if c.commands[k].privileged {
+			bullet = "*"
+		}
+		fmt.Fprintf(&help, "  %s %s %s\n", bullet, k, c.commands[k].usage)
+	}
+
+	if aliases := c.aliasNames(); len(aliases) > 0 {
+		help.WriteString("Aliases:\n")
+		for _, name := range aliases {
+			alias, _ := c.alias(name)
+			fmt.Fprintf(&help, "  - %s = %s\n", name, alias)
+		}
+	}
+	return help.String()
+}
+
+func (c *chat) renderHelp() {
+	help := c.helpText()
+	c.guiwrapper.gui.Update(func(g *gocui.Gui) error {
+		helpView, err := g.View("help")
+		if err != nil {
+			return err
+		}
+		helpView.Clear()
+		fmt.Fprint(helpView, help)
+		return nil
+	})
+}
+
 func (c *chat) showDebug(g *gocui.Gui, v *gocui.View) error {
 	c.debugActive = !c.debugActive
 	if !c.debugActive {
@@ -184,146 +295,144 @@ func (c *chat) renderDebug(s interface{}) {
 	})
 }
 
-func (c *chat) renderError(errorString string) {
-	tag := fmt.Sprintf(" %sX%s ", bgRed, reset)
-	msg := fmt.Sprintf("%s*Error sending message: %s*%s", fgBrightRed, errorString, reset)
-	c.guiwrapper.addMessage(guimessage{time.Now(), tag, msg, ""})
+// styled renders a message with style. The style is kept on the message, it
+// renders the message again when the theme or the tags change.
+func styled(ts time.Time, nick string, text string, style func() (tag string, msg string)) guimessage {
+	tag, msg := style()
+	return guimessage{ts: ts, tag: tag, msg: msg, nick: nick, text: text, style: style}
 }
 
-func (c *chat) isHighlighted(message string) bool {
-	for _, highlighted := range c.config.Highlighted {
-		if strings.Contains(strings.ToLower(message), strings.ToLower(highlighted)) {
-			return true
-		}
-	}
-	return false
+// event renders a message that is painted in a single style, like joins or mod actions.
+func (c *chat) event(ts time.Time, style string, symbol string, text string) guimessage {
+	return styled(ts, "", "", func() (string, string) {
+		return c.tag(style, symbol), c.paint(style, text)
+	})
 }
 
-func (c *chat) isTagged(user string) bool {
-	for tag := range c.config.Tags {
-		if strings.EqualFold(strings.ToLower(user), strings.ToLower(tag)) {
-			return true
-		}
+func (c *chat) renderError(errorString string) {
+	if c.headless != nil {
+		c.headless.info("error: " + errorString)
 	}
-	return false
+	c.guiwrapper.addMessage(c.event(time.Now(), "error", "X", fmt.Sprintf("*Error sending message: %s*", errorString)))
 }
 
-func (c *chat) renderMessage(m dggchat.Message) {
-	taggedNick := m.Sender.Nick
-
+// renderMessage shows a chat message, live is false for messages of the chat history.
+func (c *chat) renderMessage(m dggchat.Message, live bool) {
 	// don't show ignored users
-	if contains(c.config.Ignores, strings.ToLower(taggedNick)) {
+	if contains(c.config.Ignores, strings.ToLower(m.Sender.Nick)) {
 		return
 	}
 
-	var coloredNick string
+	c.links.add(m.Sender.Nick, m.Timestamp, m.Message)
 
-	if c.isTagged(m.Sender.Nick) {
-		coloredNick = fmt.Sprintf("%s%s %s", tagMap[c.config.Tags[strings.ToLower(m.Sender.Nick)]], taggedNick, reset) // change color of username if they are tagged
+	if rule := c.highlightFor(m); live && rule != nil && rule.Notify && !strings.EqualFold(m.Sender.Nick, c.username) {
+		c.notify(m.Sender.Nick, m.Message)
 	}
 
-	if coloredNick == "" {
-		coloredNick = fmt.Sprintf("%s%s%s", Bold, taggedNick, reset)
-	}
+	c.guiwrapper.addMessage(styled(m.Timestamp, m.Sender.Nick, m.Message, func() (string, string) {
+		return c.userTag(m.Sender.Nick), fmt.Sprintf("%s: %s", c.formatNick(m.Sender, c.theme.get("nick")), c.formatBody(m))
+	}))
+}
 
-	formattedData := m.Message
-	if c.username != "" && strings.Contains(strings.ToLower(m.Message), strings.ToLower(c.username)) || c.isHighlighted(m.Message) {
-		formattedData = fmt.Sprintf("%s%s%s%s", c.config.HighlightBg, c.config.HighlightFg, m.Message, reset) // change message color if you get mentioned or the message contains a highlighed string
-	} else if strings.HasPrefix(m.Message, ">") {
-		formattedData = fmt.Sprintf("%s%s%s", fgGreen, m.Message, reset) // greentext
+// formatBody styles the text of a chat message.
+func (c *chat) formatBody(m dggchat.Message) string {
+	if rule := c.highlightFor(m); rule != nil {
+		// change message color if you get mentioned or the message matches a highlight rule
+		style := c.highlightStyle(rule)
+		return fmt.Sprintf("%s%s%s", style, c.formatText(m.Message, style), reset)
+	}
+	if strings.HasPrefix(m.Message, ">") {
+		return c.paint("greentext", c.formatText(m.Message, c.theme.get("greentext")))
 	}
+	return c.formatText(m.Message, none)
+}
 
-	// currently not in use
-	formattedTag := "   "
+// userTag renders the tag column of a message by nick, its /tag color or blank.
+func (c *chat) userTag(nick string) string {
 	c.config.RLock()
-	if color, ok := c.config.Tags[strings.ToLower(m.Sender.Nick)]; ok {
-		formattedTag = fmt.Sprintf("%s   %s", tagMap[color], reset)
-	}
+	name, ok := c.config.Tags[strings.ToLower(nick)]
 	c.config.RUnlock()
-
-	// TODO alignment possibly
-	// var align = 23
-	// padlen := align - len(strings.TrimSpace(taggedNick)) //len of tagged, because color codes mess up calc
-	// if padlen > 0 && len(strings.TrimSpace(taggedNick)) < align {
-	// 	coloredNick = strings.Repeat(" ", padlen) + coloredNick
-	// }
-
-	msg := fmt.Sprintf("%s: %s", coloredNick, formattedData)
-	c.guiwrapper.addMessage(guimessage{m.Timestamp, formattedTag, msg, m.Sender.Nick})
+	if !ok {
+		return "   "
+	}
+	return fmt.Sprintf("%s   %s", tagStyle(name), reset)
 }
 
+// whispers are rendered into a separate buffer per conversation partner
 func (c *chat) renderPrivateMessage(pm dggchat.PrivateMessage) {
-	tag := fmt.Sprintf(" %s%s*%s ", bgBlack, fgRed, reset)
-	msg := fmt.Sprintf("%s[PM <- %s] %s %s", fgBrightWhite, pm.User.Nick, pm.Message, reset)
-	c.guiwrapper.addMessage(guimessage{pm.Timestamp, tag, msg, ""})
+	c.links.add(pm.User.Nick, pm.Timestamp, pm.Message)
+
+	c.buffers.private(pm.User.Nick).addMessage(styled(pm.Timestamp, "", pm.Message, func() (string, string) {
+		return c.tag("pm", "*"), c.paint("pm", fmt.Sprintf("[PM <- %s] %s ", pm.User.Nick, formatLinks(pm.Message, c.theme.get("pm"))))
+	}))
+
+	if c.config.Notifications.Whispers {
+		c.notify(fmt.Sprintf("PM from %s", pm.User.Nick), pm.Message)
+	}
 }
 
 func (c *chat) renderSendPrivateMessage(nick string, message string) {
-	tag := fmt.Sprintf(" %s%s*%s ", bgBlack, fgRed, reset)
-	msg := fmt.Sprintf("%s[PM -> %s] %s %s", fgBrightWhite, nick, message, reset)
-	c.guiwrapper.addMessage(guimessage{time.Now(), tag, msg, ""})
+	c.buffers.private(nick).addMessage(styled(time.Now(), "", message, func() (string, string) {
+		return c.tag("pm", "*"), c.paint("pm", fmt.Sprintf("[PM -> %s] %s ", nick, message))
+	}))
 }
 
 func (c *chat) renderBroadcast(b dggchat.Broadcast) {
-	tag := fmt.Sprintf(" %s!%s ", fgBrightYellow, reset)
 	extra := ""
 	if b.Sender.Nick != "" {
 		extra = fmt.Sprintf("from %s ", b.Sender.Nick)
 	}
-	msg := fmt.Sprintf("%sBROADCAST %s: %s %s", fgBrightYellow, extra, b.Message, reset)
-	c.guiwrapper.addMessage(guimessage{b.Timestamp, tag, msg, ""})
+	c.guiwrapper.addMessage(c.event(b.Timestamp, "broadcast", "!", fmt.Sprintf("BROADCAST %s: %s ", extra, b.Message)))
 }
 
-func (c *chat) renderJoin(join dggchat.RoomAction) {
-	if contains(c.config.Stalks, strings.ToLower(join.User.Nick)) || c.config.ShowJoinLeave {
-		tag := fmt.Sprintf(" %s>%s ", bgGreen, reset)
-		msg := fmt.Sprintf("%s%s joined!%s", fgGreen, join.User.Nick, reset)
-		c.guiwrapper.addMessage(guimessage{join.Timestamp, tag, msg, ""})
+func (c *chat) renderJoin(join dggchat.RoomAction, live bool) {
+	stalked := contains(c.config.Stalks, strings.ToLower(join.User.Nick))
+	if live && stalked && c.config.Notifications.Stalks {
+		c.notify("tsgg", fmt.Sprintf("%s joined", join.User.Nick))
+	}
+
+	if stalked || c.config.ShowJoinLeave {
+		c.guiwrapper.addMessage(c.event(join.Timestamp, "join", ">", fmt.Sprintf("%s joined!", join.User.Nick)))
 	}
 }
 
 func (c *chat) renderQuit(quit dggchat.RoomAction) {
 	if contains(c.config.Stalks, strings.ToLower(quit.User.Nick)) || c.config.ShowJoinLeave {
-		tag := fmt.Sprintf(" %s<%s ", bgRed, reset)
-		msg := fmt.Sprintf("%s%s left.%s", fgRed, quit.User.Nick, reset)
-		c.guiwrapper.addMessage(guimessage{quit.Timestamp, tag, msg, ""})
+		c.guiwrapper.addMessage(c.event(quit.Timestamp, "quit", "<", fmt.Sprintf("%s left.", quit.User.Nick)))
 	}
 }
 
 func (c *chat) renderMute(mute dggchat.Mute) {
-	tag := fmt.Sprintf(" %s!%s ", bgYellow, reset)
-	msg := fmt.Sprintf("%s%s muted by %s%s", fgYellow, mute.Target.Nick, mute.Sender.Nick, reset)
-	c.guiwrapper.addMessage(guimessage{mute.Timestamp, tag, msg, ""})
+	c.guiwrapper.addMessage(c.event(mute.Timestamp, "mod_action", "!", fmt.Sprintf("%s muted by %s", mute.Target.Nick, mute.Sender.Nick)))
+	c.recordModAction(modAction{ts: mute.Timestamp, kind: "mute", sender: mute.Sender.Nick, target: mute.Target.Nick})
 }
 
 func (c *chat) renderUnmute(unmute dggchat.Mute) {
-	tag := fmt.Sprintf(" %s!%s ", bgYellow, reset)
-	msg := fmt.Sprintf("%s%s unmuted by %s%s", fgYellow, unmute.Target.Nick, unmute.Sender.Nick, reset)
-	c.guiwrapper.addMessage(guimessage{unmute.Timestamp, tag, msg, ""})
+	c.guiwrapper.addMessage(c.event(unmute.Timestamp, "mod_action", "!", fmt.Sprintf("%s unmuted by %s", unmute.Target.Nick, unmute.Sender.Nick)))
+	c.recordModAction(modAction{ts: unmute.Timestamp, kind: "unmute", sender: unmute.Sender.Nick, target: unmute.Target.Nick})
 }
 
 func (c *chat) renderBan(ban dggchat.Ban) {
-	tag := fmt.Sprintf(" %s!%s ", bgRed, reset)
-	msg := fmt.Sprintf("%s%s banned by %s%s", fgRed, ban.Target.Nick, ban.Sender.Nick, reset)
-	c.guiwrapper.addMessage(guimessage{ban.Timestamp, tag, msg, ""})
+	c.guiwrapper.addMessage(c.event(ban.Timestamp, "mod_action", "!", fmt.Sprintf("%s banned by %s", ban.Target.Nick, ban.Sender.Nick)))
+	c.recordModAction(modAction{ts: ban.Timestamp, kind: "ban", sender: ban.Sender.Nick, target: ban.Target.Nick})
 }
 
 func (c *chat) renderUnban(unban dggchat.Ban) {
-	tag := fmt.Sprintf(" %s!%s ", bgRed, reset)
-	msg := fmt.Sprintf("%s%s unbanned by %s%s", fgRed, unban.Target.Nick, unban.Sender.Nick, reset)
-	c.guiwrapper.addMessage(guimessage{unban.Timestamp, tag, msg, ""})
+	c.guiwrapper.addMessage(c.event(unban.Timestamp, "mod_action", "!", fmt.Sprintf("%s unbanned by %s", unban.Target.Nick, unban.Sender.Nick)))
+	c.recordModAction(modAction{ts: unban.Timestamp, kind: "unban", sender: unban.Sender.Nick, target: unban.Target.Nick})
 }
 
 func (c *chat) renderSubOnly(so dggchat.SubOnly) {
-	tag := fmt.Sprintf(" %s$%s ", bgMagenta, reset)
-	msg := fmt.Sprintf("%s%s changed subonly mode to: %t %s", fgMagenta, so.Sender.Nick, so.Active, reset)
-	c.guiwrapper.addMessage(guimessage{so.Timestamp, tag, msg, ""})
+	c.status.setSubOnly(so.Active)
+	c.guiwrapper.addMessage(c.event(so.Timestamp, "subonly", "$", fmt.Sprintf("%s changed subonly mode to: %t ", so.Sender.Nick, so.Active)))
+	c.recordModAction(modAction{ts: so.Timestamp, kind: "subonly", sender: so.Sender.Nick, subonly: so.Active})
 }
 
 func (c *chat) renderCommand(s string) {
-	tag := fmt.Sprintf(" %sI%s ", bgWhite, reset)
-	msg := fmt.Sprintf("%s%s%s", fgWhite, s, reset)
-	c.guiwrapper.addMessage(guimessage{time.Now(), tag, msg, ""})
+	if c.headless != nil {
+		c.headless.info(s)
+	}
+	c.guiwrapper.addMessage(c.event(time.Now(), "info", "I", s))
 }
 
 func (c *chat) renderUsers(users []dggchat.User) {
@@ -338,12 +447,10 @@ func (c *chat) renderUsers(users []dggchat.User) {
 		c.sortUsers(users)
 
 		var usersList string
+		c.userList = c.userList[:0]
 		for _, u := range users {
-			if c.isTagged(u.Nick) {
-				usersList += fmt.Sprintf("%s%s%s\n", tagMap[c.config.Tags[strings.ToLower(u.Nick)]], u.Nick, reset)
-			} else {
-				usersList += fmt.Sprintf("%s%s\n", u.Nick, reset)
-			}
+			usersList += c.formatNick(u, none) + "\n"
+			c.userList = append(c.userList, u.Nick)
 		}
 
 		userView.Clear()
@@ -366,40 +473,83 @@ func indexOf(s []string, e string) int {
 	return -1
 }
 
+// historyUp moves up a line in multi-line input, otherwise to the previous sent message.
 func (c *chat) historyUp(g *gocui.Gui, v *gocui.View) error {
-	if c.historyIndex > maxChatHistory-2 || (c.historyIndex+1) > len(c.messageHistory)-1 {
+	if c.historySearch != nil {
+		c.searchHistory()
+		return nil
+	}
+	if c.input.moveLine(-1) {
+		return nil
+	}
+	if (c.historyIndex + 1) > len(c.messageHistory)-1 {
 		return nil
 	}
 	c.historyIndex++
-	v.Clear()
-	v.SetCursor(0, 0)
-	v.Write([]byte(c.messageHistory[c.historyIndex]))
-	v.MoveCursor(len(c.messageHistory[c.historyIndex]), 0, true)
+	c.input.set(c.messageHistory[c.historyIndex])
 	return nil
 }
 
 func (c *chat) historyDown(g *gocui.Gui, v *gocui.View) error {
+	if c.historySearch != nil {
+		c.newerHistoryMatch()
+		return nil
+	}
+	if c.input.moveLine(1) {
+		return nil
+	}
 	if c.historyIndex < 1 {
 		c.historyIndex = -1
-		v.Clear()
-		v.SetCursor(0, 0)
+		c.input.clear()
 		return nil
 	}
 
 	c.historyIndex--
-	v.Clear()
-	v.SetCursor(0, 0)
-	v.Write([]byte(c.messageHistory[c.historyIndex]))
-	v.MoveCursor(len(c.messageHistory[c.historyIndex]), 0, true)
+	c.input.set(c.messageHistory[c.historyIndex])
 	return nil
 }
 
-func scroll(dy int, chat *chat, view string) error {
-	chat.guiwrapper.Lock()
-	defer chat.guiwrapper.Unlock()
+// jumpToUnread scrolls the messages view to the unread marker of the active buffer.
+func (c *chat) jumpToUnread(g *gocui.Gui, v *gocui.View) error {
+	messageView, err := g.View("messages")
+	if err != nil {
+		return err
+	}
+	width, height := messageView.Size()
+
+	gw := c.buffers.active()
+	gw.Lock()
+	content, markerLine, lines := gw.content(width, nil)
+	if markerLine == -1 {
+		gw.Unlock()
+		c.renderCommand("No unread messages")
+		return nil
+	}
+
+	messageView.Clear()
+	fmt.Fprint(messageView, content)
+	if lines-markerLine <= height {
+		// the marker is on the last page
+		messageView.Autoscroll = true
+		gw.scrolledUp = false
+	} else {
+		messageView.Autoscroll = false
+		gw.scrolledUp = true
+		messageView.SetOrigin(0, markerLine)
+	}
+	gw.newMessages = 0
+	messageView.Title = gw.title()
+	gw.Unlock()
+	return nil
+}
+
+func scroll(g *gocui.Gui, dy int, chat *chat, view string) error {
+	gw := chat.buffers.active()
+	gw.Lock()
+	defer gw.Unlock()
 
 	// Grab the view that we want to scroll.
-	v, _ := chat.guiwrapper.gui.View(view)
+	v, _ := g.View(view)
 
 	// Get the size and position of the view.
 	_, y := v.Size()
@@ -415,11 +565,20 @@ func scroll(dy int, chat *chat, view string) error {
 	if ty > lines && view == "messages" {
 		// Set autoscroll to normal again.
 		v.Autoscroll = true
-		chat.guiwrapper.redraw() // see comment in redraw()
+		gw.scrolledUp = false
+		gw.newMessages = 0
+		v.Title = gw.title()
+		gw.redraw() // see comment in redraw()
 		return nil
 	}
 	// Set autoscroll to false and scroll.
 	v.Autoscroll = false
+	if view == "messages" && !gw.scrolledUp {
+		// leaving the bottom, new messages are unread from here on
+		gw.scrolledUp = true
+		gw.newMessages = 0
+		gw.markPending = true
+	}
 
 	// If the scrolling "speed" (dy) is set too high, make sure we don't scroll into negative.
 	if ty < 0 {
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+const (
+	defaultUserHistory = 50
+	maxUserHistory     = 1000
+)
+
+// pastMessage is a message of a user found by /history.
+type pastMessage struct {
+	ts   time.Time
+	text string
+}
+
+// key identifies a message across the sources, the log and the history
+// endpoint only have second precision.
+func (m pastMessage) key() string {
+	return strconv.FormatInt(m.ts.Unix(), 10) + " " + m.text
+}
+
+// bufferMessages returns the messages of nick still in the main buffer.
+func (c *chat) bufferMessages(nick string) []pastMessage {
+	gw := c.guiwrapper
+	gw.RLock()
+	defer gw.RUnlock()
+
+	var found []pastMessage
+	for _, m := range gw.messages {
+		if m.text != "" && strings.EqualFold(m.nick, nick) {
+			found = append(found, pastMessage{m.ts, m.text})
+		}
+	}
+	return found
+}
+
+// logMessages reads the messages of nick from the text logs, newest days first
+// until n messages are found.
+func logMessages(dir string, nick string, n int) ([]pastMessage, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(files)))
+
+	var found []pastMessage
+	for _, file := range files {
+		day, err := readLogMessages(file, nick)
+		if err != nil {
+			return found, err
+		}
+		found = append(day, found...)
+		if len(found) >= n {
+			break
+		}
+	}
+	return found, nil
+}
+
+func readLogMessages(file string, nick string) ([]pastMessage, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var found []pastMessage
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		// "[2006-01-02 15:04:05] nick: message", see formatLogEntry
+		line := scanner.Text()
+		end := strings.Index(line, "] ")
+		if !strings.HasPrefix(line, "[") || end == -1 {
+			continue
+		}
+		rest := line[end+2:]
+		if len(rest) < len(nick)+2 || !strings.EqualFold(rest[:len(nick)], nick) || rest[len(nick):len(nick)+2] != ": " {
+			continue
+		}
+		ts, err := time.ParseInLocation("2006-01-02 15:04:05", line[1:end], time.Local)
+		if err != nil {
+			continue
+		}
+		found = append(found, pastMessage{ts, rest[len(nick)+2:]})
+	}
+	return found, scanner.Err()
+}
+
+// messages filters the history endpoint for the messages of nick.
+func (h *historyLoader) messages(nick string) ([]pastMessage, error) {
+	received, err := h.fetch()
+	if err != nil {
+		return nil, err
+	}
+
+	var found []pastMessage
+	for _, line := range received {
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) != 2 || parts[0] != "MSG" {
+			continue
+		}
+		var e historyEvent
+		if err := json.Unmarshal([]byte(parts[1]), &e); err != nil || !strings.EqualFold(e.Nick, nick) {
+			continue
+		}
+		found = append(found, pastMessage{time.Unix(e.Timestamp/1000, 0), e.Data})
+	}
+	return found, nil
+}
+
+// userHistory collects the last n messages of nick from the main buffer, the
+// chat log and the history endpoint, oldest first. Sources that fail are
+// skipped and reported in the debug view.
+func (c *chat) userHistory(nick string, n int) []pastMessage {
+	sources := [][]pastMessage{c.bufferMessages(nick)}
+
+	if c.chatlog != nil {
+		found, err := logMessages(c.chatlog.dir, nick, n)
+		if err != nil {
+			c.renderDebug(fmt.Sprintf("history: reading chat log: %v", err))
+		}
+		sources = append(sources, found)
+	}
+
+	if c.history != nil {
+		found, err := c.history.messages(nick)
+		if err != nil {
+			c.renderDebug(fmt.Sprintf("history: %v", err))
+		}
+		sources = append(sources, found)
+	}
+
+	seen := make(map[string]bool)
+	var all []pastMessage
+	for _, source := range sources {
+		for _, m := range source {
+			if seen[m.key()] {
+				continue
+			}
+			seen[m.key()] = true
+			all = append(all, m)
+		}
+	}
+
+	sort.SliceStable(all, func(i, j int) bool { return all[i].ts.Before(all[j].ts) })
+	if len(all) > n {
+		all = all[len(all)-n:]
+	}
+	return all
+}
+
+func showUserHistory(c *chat, tokens []string) error {
+	if len(tokens) < 2 || len(tokens) > 3 {
+		return errors.New("usage: /history user [count]")
+	}
+
+	n := defaultUserHistory
+	if len(tokens) == 3 {
+		var err error
+		n, err = strconv.Atoi(tokens[2])
+		if err != nil || n < 1 {
+			return errors.New("count must be a positive number")
+		}
+		if n > maxUserHistory {
+			n = maxUserHistory
+		}
+	}
+
+	// the log and the history endpoint may take a while
+	nick := tokens[1]
+	go func() {
+		c.renderUserHistory(nick, c.userHistory(nick, n))
+	}()
+	return nil
+}
+
+// renderUserHistory shows the messages in the history overlay, or in chat when running headless.
+func (c *chat) renderUserHistory(nick string, messages []pastMessage) {
+	if len(messages) == 0 {
+		c.renderCommand(fmt.Sprintf("No messages from %s found", nick))
+		return
+	}
+
+	timeformat := "Jan 2 " + c.config.Timeformat
+	if c.headless != nil {
+		for _, m := range messages {
+			c.renderCommand(fmt.Sprintf("[%s] %s: %s", m.ts.Format(timeformat), nick, m.text))
+		}
+		return
+	}
+
+	c.guiwrapper.gui.Update(func(g *gocui.Gui) error {
+		historyView, err := g.View("userhistory")
+		if err != nil {
+			return err
+		}
+		historyView.Clear()
+		historyView.Title = fmt.Sprintf(" %s: last %d messages, esc to close ", nick, len(messages))
+		for _, m := range messages {
+			fmt.Fprintf(historyView, "%s[%s]%s %s\n", c.theme.get("timestamp"), m.ts.Format(timeformat), reset, c.formatText(m.text, none))
+		}
+
+		// start at the newest message
+		width, height := historyView.Size()
+		lines := 0
+		for _, m := range messages {
+			lines += wrappedLines(fmt.Sprintf("[%s] %s", m.ts.Format(timeformat), m.text), width)
+		}
+		oy := lines - height
+		if oy < 0 {
+			oy = 0
+		}
+		historyView.SetOrigin(0, oy)
+
+		historyView.Visible = true
+		if _, err := g.SetViewOnTop("userhistory"); err != nil {
+			return err
+		}
+		_, err = g.SetCurrentView("userhistory")
+		return err
+	})
+}
+
+func (c *chat) closeUserHistory(g *gocui.Gui, v *gocui.View) error {
+	historyView, err := g.View("userhistory")
+	if err != nil {
+		return err
+	}
+	historyView.Visible = false
+
+	// opened from the context menu, go back to the selection
+	view := "input"
+	if c.selection != nil {
+		view = c.selection.view
+	}
+	_, err = g.SetCurrentView(view)
+	return err
+}
+
+func (c *chat) setUserHistoryKeybindings(g *gocui.Gui) error {
+	if err := g.SetKeybinding("userhistory", gocui.KeyEsc, gocui.ModNone, c.closeUserHistory); err != nil {
+		return err
+	}
+	keys := map[gocui.Key]int{
+		gocui.KeyArrowUp:   -1,
+		gocui.KeyArrowDown: 1,
+		gocui.KeyPgup:      -c.config.PageUpDownSpeed,
+		gocui.KeyPgdn:      c.config.PageUpDownSpeed,
+	}
+	for key, dy := range keys {
+		dy := dy
+		err := g.SetKeybinding("userhistory", key, gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
+			return scroll(g, dy, c, "userhistory")
+		})
+		if err != nil {
+			return err
+		}
+	}
+	c.mustAddScroll(g, "userhistory", c.config.ScrollingSpeed, gocui.MouseWheelUp, gocui.MouseWheelDown)
+	return nil
+}
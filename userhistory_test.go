@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/MemeLabs/dggchat"
+)
+
+func TestUserHistory(t *testing.T) {
+	day := time.Date(2020, 5, 1, 12, 0, 0, 0, time.Local)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `["MSG {\"nick\":\"bob\",\"timestamp\":%d,\"data\":\"from the endpoint\"}",`+
+			`"MSG {\"nick\":\"bob\",\"timestamp\":%d,\"data\":\"OMEGALUL bob: everywhere\"}",`+
+			`"MSG {\"nick\":\"alice\",\"timestamp\":%d,\"data\":\"not bob\"}"]`,
+			day.Add(2*time.Minute).Unix()*1000, day.Add(4*time.Minute).Unix()*1000, day.Add(3*time.Minute).Unix()*1000)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.FlairBadges = true
+	cfg.Emotes.Substitutes = map[string]string{"OMEGALUL": "😂"}
+	c := newTestChat(t, cfg, &fakeSession{})
+	c.setEmotes([]string{"OMEGALUL"}, nil)
+	var err error
+	c.chatlog, err = newChatlog(t.TempDir(), "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.chatlog.close()
+	c.history = newHistoryLoader(srv.URL)
+
+	yesterday := day.Add(-24 * time.Hour)
+	log := formatLogEntry(logEntry{Type: "MSG", Timestamp: yesterday, Nick: "bob", Data: "from the log"}) + "\n" +
+		formatLogEntry(logEntry{Type: "MSG", Timestamp: yesterday, Nick: "bobby", Data: "someone else"}) + "\n"
+	if err := ioutil.WriteFile(filepath.Join(c.chatlog.dir, "2020-04-30.log"), []byte(log), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// in the buffer and the endpoint, shown once
+	c.renderMessage(dggchat.Message{Sender: dggchat.User{Nick: "bob"}, Timestamp: day.Add(2 * time.Minute), Message: "from the endpoint"}, true)
+	// in all three, the buffer shows it with the emote substituted and a badge
+	everywhere := dggchat.Message{
+		Sender:    dggchat.User{Nick: "bob", Features: []string{dggchat.FeatureSubscriber}},
+		Timestamp: day.Add(4*time.Minute + 300*time.Millisecond),
+		Message:   "OMEGALUL bob: everywhere",
+	}
+	c.logEvent(messageEntry(everywhere))
+	c.renderMessage(everywhere, true)
+	c.renderMessage(dggchat.Message{Sender: dggchat.User{Nick: "Bob"}, Timestamp: day.Add(5 * time.Minute), Message: "from the buffer"}, true)
+
+	var texts []string
+	for _, m := range c.userHistory("bob", 10) {
+		texts = append(texts, m.text)
+	}
+	if want := []string{"from the log", "from the endpoint", "OMEGALUL bob: everywhere", "from the buffer"}; !reflect.DeepEqual(texts, want) {
+		t.Errorf("history %q, want %q", texts, want)
+	}
+
+	if got := c.userHistory("bob", 1); len(got) != 1 || got[0].text != "from the buffer" {
+		t.Errorf("history limited to 1 is %v", got)
+	}
+}
+
+func TestHistoryCommand(t *testing.T) {
+	c := newTestChat(t, testConfig(), &fakeSession{})
+	c.handleInput("/history bob zero")
+	if countLines(c.guiwrapper, "count must be a positive number") != 1 {
+		t.Errorf("invalid count accepted, rendered %q", lines(c.guiwrapper))
+	}
+
+	c.handleInput("/history nobody")
+	waitFor(t, "no messages", func() bool { return countLines(c.guiwrapper, "No messages from nobody found") == 1 })
+}